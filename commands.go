@@ -0,0 +1,581 @@
+package main
+
+import (
+	"bytes"
+	"clan/pkg/checkpointer"
+	"clan/pkg/clan"
+	"clan/pkg/tools"
+	"clan/pkg/workflow"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/google/uuid"
+	"github.com/mitchellh/go-wordwrap"
+	"github.com/rodaine/table"
+	"gopkg.in/yaml.v3"
+)
+
+// options holds the flags shared by the commands. Each command only
+// registers the flags it uses.
+type options struct {
+	workflowID string
+	workspace  string
+	output     string
+	checkpoint string
+	logLevel   string
+	answer     string
+}
+
+func newFlagSet(name string, arguments string, opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: clan %s [flags] %s\n\nFlags:\n", name, arguments)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&opts.logLevel, "log-level", "info", "Log level, one of debug, info, warn or error")
+	return fs
+}
+
+func (opts *options) runFlags(fs *flag.FlagSet) {
+	fs.StringVar(&opts.workspace, "workspace", "", "Directory the file and command tools are confined to, overrides the manifest")
+	fs.StringVar(&opts.output, "output", "text", "Output format, text or jsonl")
+	opts.checkpointFlag(fs)
+}
+
+func (opts *options) checkpointFlag(fs *flag.FlagSet) {
+	fs.StringVar(&opts.checkpoint, "checkpoint", "", "Path of a sqlite3 checkpoint database, overrides the manifest")
+}
+
+// parse parses flags that may appear before, between or after the
+// positional arguments and checks the number of positional arguments
+func parse(fs *flag.FlagSet, opts *options, args []string, minArgs int, maxArgs int) ([]string, error) {
+	var positional []string
+	for {
+		err := fs.Parse(args)
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, &usageError{msg: err.Error()}
+		}
+
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if len(positional) < minArgs || len(positional) > maxArgs {
+		fs.Usage()
+		return nil, &usageError{msg: fmt.Sprintf("Invalid arguments for %s", fs.Name())}
+	}
+
+	if opts.output != "" && opts.output != "text" && opts.output != "jsonl" {
+		return nil, &usageError{msg: fmt.Sprintf("Unsupported output format %s", opts.output)}
+	}
+
+	var level slog.Level
+	err := level.UnmarshalText([]byte(opts.logLevel))
+	if err != nil {
+		return nil, &usageError{msg: fmt.Sprintf("Invalid log level %s", opts.logLevel)}
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	return positional, nil
+}
+
+// apply overrides the manifest with the values passed as flags
+func (opts *options) apply(def *workflow.WorkflowDefinition) {
+	if opts.workspace != "" {
+		def.Workspace = opts.workspace
+	}
+
+	if opts.checkpoint != "" {
+		def.Checkpoint = &workflow.CheckpointDefinition{Type: "sqlite3", ConnectionString: opts.checkpoint}
+	}
+}
+
+func runCommand(ctx context.Context, args []string) error {
+	opts := options{}
+	fs := newFlagSet("run", "<manifest>", &opts)
+	fs.StringVar(&opts.workflowID, "id", "", "ID of the workflow run, generated when empty")
+	opts.runFlags(fs)
+	positional, err := parse(fs, &opts, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	def, err := parseWorkflow(positional[0])
+	if err != nil {
+		return fmt.Errorf("unable to parse your workflow definition: %w", err)
+	}
+	opts.apply(def)
+
+	workflowID := opts.workflowID
+	if workflowID == "" {
+		workflowID = uuid.New().String()
+	}
+
+	run, err := workflow.Execute(ctx, def, workflowID)
+	if err != nil {
+		return fmt.Errorf("unable to execute your workflow: %w", err)
+	}
+
+	if opts.output == "jsonl" {
+		renderJSONL(ctx, run.Events(), workflowID, false, &opts)
+	} else {
+		fmt.Printf(color.BlueString("WORKFLOW ID: ")+"%s\n", workflowID)
+		render(ctx, run.Events(), &opts)
+	}
+	return wait(run)
+}
+
+func resumeCommand(ctx context.Context, args []string) error {
+	opts := options{}
+	fs := newFlagSet("resume", "<workflow-id> <manifest>", &opts)
+	opts.runFlags(fs)
+	fs.StringVar(&opts.answer, "answer", "", "Answer to the question the run stopped waiting for")
+	positional, err := parse(fs, &opts, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	workflowID := positional[0]
+
+	def, err := parseWorkflow(positional[1])
+	if err != nil {
+		return fmt.Errorf("unable to parse your workflow definition: %w", err)
+	}
+	opts.apply(def)
+
+	run, err := workflow.Resume(ctx, def, workflowID)
+	if err != nil {
+		return fmt.Errorf("unable to resume your workflow: %w", err)
+	}
+
+	if opts.output == "jsonl" {
+		renderJSONL(ctx, run.Events(), workflowID, true, &opts)
+	} else {
+		fmt.Printf(color.BlueString("RESUMING WORKFLOW ID: ")+"%s\n", workflowID)
+		render(ctx, run.Events(), &opts)
+	}
+	if opts.answer != "" {
+		fmt.Fprintln(os.Stderr, "Warning: --answer was not used, the run did not ask the question it stopped waiting for")
+	}
+	return wait(run)
+}
+
+// exitCodes are the exit statuses of runs that did not reach End
+var exitCodes = map[workflow.StopReason]int{
+	workflow.StopFailed:         1,
+	workflow.StopBudgetExceeded: 3,
+	workflow.StopTraversalDepth: 4,
+	workflow.StopAwaitingInput:  5,
+	workflow.StopInterrupted:    6,
+	workflow.StopCancelled:      130,
+}
+
+// wait waits for a run whose events have been rendered and returns an
+// exitError when it did not reach End
+func wait(run *workflow.Run) error {
+	result, _ := run.Wait()
+	if result.Reason == workflow.StopCompleted {
+		return nil
+	}
+
+	return &exitError{code: exitCodes[result.Reason]}
+}
+
+func validateCommand(args []string) error {
+	opts := options{}
+	fs := newFlagSet("validate", "<manifest>", &opts)
+	positional, err := parse(fs, &opts, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	manifest := positional[0]
+
+	workflowBytes, err := os.ReadFile(manifest)
+	if err != nil {
+		return err
+	}
+
+	// Unlike runs, validation rejects fields that Clan does not know about
+	decoder := yaml.NewDecoder(bytes.NewReader(workflowBytes))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&workflow.WorkflowDefinition{})
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		for _, e := range typeErr.Errors {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", manifest, e)
+		}
+		return fmt.Errorf("%s is invalid", manifest)
+	}
+
+	def, err := workflow.ParseDefinition(workflowBytes)
+	if err != nil {
+		return fmt.Errorf("%s is invalid: %w", manifest, err)
+	}
+
+	err = def.Validate()
+	var validationErrs workflow.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		for _, e := range validationErrs {
+			fmt.Fprintf(os.Stderr, "%s:%d:%d: %s: %s\n", manifest, e.Line, e.Column, e.Path, e.Message)
+		}
+		return fmt.Errorf("%s is invalid", manifest)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s is valid\n", manifest)
+	return nil
+}
+
+func schemaCommand(args []string) error {
+	opts := options{}
+	fs := newFlagSet("schema", "", &opts)
+	_, err := parse(fs, &opts, args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	schemaBytes, err := workflow.SchemaJSON()
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(schemaBytes)
+	return err
+}
+
+func graphCommand(args []string) error {
+	opts := options{}
+	fs := newFlagSet("graph", "<manifest>", &opts)
+	positional, err := parse(fs, &opts, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	def, err := parseWorkflow(positional[0])
+	if err != nil {
+		return fmt.Errorf("unable to parse your workflow definition: %w", err)
+	}
+
+	fmt.Print(def.Mermaid())
+	return nil
+}
+
+func runsListCommand(args []string) error {
+	opts := options{}
+	fs := newFlagSet("runs list", "[<manifest>]", &opts)
+	opts.checkpointFlag(fs)
+	positional, err := parse(fs, &opts, args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	cp, err := newCheckpointer(&opts, positional)
+	if err != nil {
+		return err
+	}
+
+	workflows, err := cp.ListWorkflows()
+	if err != nil {
+		return err
+	}
+
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+	tbl := table.New("Workflow ID", "Status", "Last Node", "Depth", "Started", "Updated")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+	for _, w := range workflows {
+		status := "resumable"
+		if w.LastCheckpoint.NodeName == clan.End {
+			status = "completed"
+		}
+		tbl.AddRow(w.WorkflowID, status, w.LastCheckpoint.NodeName, w.LastCheckpoint.CurrentDepth,
+			w.StartedAt.Local().Format("2006-01-02 15:04:05"), w.LastCheckpoint.Timestamp.Local().Format("2006-01-02 15:04:05"))
+	}
+	tbl.Print()
+	return nil
+}
+
+func runsShowCommand(args []string) error {
+	opts := options{}
+	fs := newFlagSet("runs show", "<workflow-id> [<manifest>]", &opts)
+	opts.checkpointFlag(fs)
+	positional, err := parse(fs, &opts, args, 1, 2)
+	if err != nil {
+		return err
+	}
+	workflowID := positional[0]
+
+	cp, err := newCheckpointer(&opts, positional[1:])
+	if err != nil {
+		return err
+	}
+
+	checkpoints, err := cp.ListAll(workflowID)
+	if err != nil {
+		return err
+	}
+
+	if len(checkpoints) == 0 {
+		return fmt.Errorf("no checkpoints found for workflow %s", workflowID)
+	}
+
+	fmt.Printf(color.BlueString("WORKFLOW ID: ")+"%s\n", workflowID)
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+	tbl := table.New("Depth", "Node", "Time")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+	for _, c := range checkpoints {
+		tbl.AddRow(c.CurrentDepth, c.NodeName, c.Timestamp.Local().Format("2006-01-02 15:04:05"))
+	}
+	tbl.Print()
+
+	last := checkpoints[len(checkpoints)-1]
+	state := workflow.WorkflowState{}
+	err = json.Unmarshal([]byte(last.State), &state)
+	if err != nil {
+		return err
+	}
+
+	for _, summary := range state.Summaries {
+		fmt.Printf(color.BlueString("SUMMARY FROM %s: ")+"%s\n", summary.AgentName, summary.Summary)
+	}
+
+	if len(state.Plan) > 0 {
+		printPlan(state.Plan)
+	}
+	printUsage(state)
+
+	if last.NodeName != clan.End {
+		fmt.Printf("Run `clan resume %s <manifest>` to continue from %s\n", workflowID, last.NodeName)
+	}
+	return nil
+}
+
+func runsStateCommand(args []string) error {
+	opts := options{}
+	fs := newFlagSet("runs state", "<workflow-id> <manifest>", &opts)
+	opts.checkpointFlag(fs)
+	positional, err := parse(fs, &opts, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	def, err := parseWorkflow(positional[1])
+	if err != nil {
+		return fmt.Errorf("unable to parse your workflow definition: %w", err)
+	}
+	opts.apply(def)
+
+	snapshot, err := workflow.LastSnapshot(def, positional[0])
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(snapshot)
+}
+
+func runsEditCommand(args []string) error {
+	opts := options{}
+	var file string
+	fs := newFlagSet("runs edit", "<workflow-id> <manifest>", &opts)
+	fs.StringVar(&file, "file", "", "File with the new state as printed by runs state, - for stdin, instead of opening $EDITOR")
+	opts.checkpointFlag(fs)
+	positional, err := parse(fs, &opts, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	workflowID := positional[0]
+
+	def, err := parseWorkflow(positional[1])
+	if err != nil {
+		return fmt.Errorf("unable to parse your workflow definition: %w", err)
+	}
+	opts.apply(def)
+
+	snapshot, err := workflow.LastSnapshot(def, workflowID)
+	if err != nil {
+		return err
+	}
+
+	current, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	var edited []byte
+	switch file {
+	case "":
+		edited, err = editInEditor(current)
+	case "-":
+		edited, err = io.ReadAll(os.Stdin)
+	default:
+		edited, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(bytes.TrimSpace(edited), bytes.TrimSpace(current)) {
+		fmt.Println("No changes")
+		return nil
+	}
+
+	// Unknown fields are most likely typos that would otherwise be dropped
+	decoder := json.NewDecoder(bytes.NewReader(edited))
+	decoder.DisallowUnknownFields()
+	updated := workflow.Snapshot{}
+	err = decoder.Decode(&updated)
+	if err != nil {
+		return fmt.Errorf("invalid state: %w", err)
+	}
+
+	err = workflow.SaveSnapshot(def, workflowID, updated)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Saved, run `clan resume %s <manifest>` to continue from %s\n", workflowID, updated.Node)
+	return nil
+}
+
+// editInEditor opens content in $EDITOR, vi when it is not set, and returns
+// the file once the editor has exited
+func editInEditor(content []byte) ([]byte, error) {
+	f, err := os.CreateTemp("", "clan-state-*.json")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(content)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	err = f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	cmd := exec.Command(editor[0], append(editor[1:], f.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("editor %s failed: %w", editor[0], err)
+	}
+
+	return os.ReadFile(f.Name())
+}
+
+func toolsListCommand(args []string) error {
+	opts := options{}
+	fs := newFlagSet("tools list", "[<manifest>]", &opts)
+	positional, err := parse(fs, &opts, args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	var starlarkTools []tools.StarlarkTool
+	if len(positional) > 0 {
+		def, err := parseWorkflow(positional[0])
+		if err != nil {
+			return fmt.Errorf("unable to parse your workflow definition: %w", err)
+		}
+		starlarkTools = def.Tools
+	}
+
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+	tbl := table.New("Name", "Description")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+	for _, t := range tools.AllTools(tools.Workspace{}, tools.CommandOptions{}, starlarkTools) {
+		schema := t.Schema()
+		tbl.AddRow(schema.Name, wordwrap.WrapString(schema.Description, 100))
+	}
+	tbl.Print()
+	return nil
+}
+
+// newCheckpointer opens the checkpoint database passed as a flag or the one
+// configured in the manifest
+func newCheckpointer(opts *options, manifest []string) (checkpointer.Checkpointer, error) {
+	if opts.checkpoint != "" {
+		return checkpointer.NewCheckpointerWithName("sqlite3", opts.checkpoint)
+	}
+
+	if len(manifest) == 0 {
+		return nil, &usageError{msg: "Please pass a manifest or --checkpoint"}
+	}
+
+	def, err := parseWorkflow(manifest[0])
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse your workflow definition: %w", err)
+	}
+
+	if def.Checkpoint == nil {
+		return nil, workflow.NoCheckpointerDefinedErr
+	}
+
+	return checkpointer.NewCheckpointerWithName(def.Checkpoint.Type, def.Checkpoint.ConnectionString)
+}
+
+// parseWorkflow reads a manifest. A relative workspace is resolved against
+// the manifest's directory so that runs don't depend on where clan is started.
+func parseWorkflow(workflowPath string) (*workflow.WorkflowDefinition, error) {
+	workflowBytes, err := os.ReadFile(workflowPath)
+	if err != nil {
+		return nil, err
+	}
+
+	def, err := workflow.ParseDefinition(workflowBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Paths in the manifest are relative to it rather than to the current
+	// directory
+	resolve := func(path *string) {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(filepath.Dir(workflowPath), *path)
+		}
+	}
+	resolve(&def.Workspace)
+	for i := range def.Agents {
+		resolve(&def.Agents[i].Fixture)
+	}
+	if def.Cassette != nil {
+		resolve(&def.Cassette.Path)
+	}
+	// SQLite URIs and in-memory databases are not paths
+	if def.Checkpoint != nil && def.Checkpoint.Type == "sqlite3" &&
+		def.Checkpoint.ConnectionString != ":memory:" && !strings.HasPrefix(def.Checkpoint.ConnectionString, "file:") {
+		resolve(&def.Checkpoint.ConnectionString)
+	}
+
+	return def, nil
+}
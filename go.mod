@@ -4,7 +4,9 @@ go 1.22.3
 
 require (
 	github.com/fatih/color v1.17.0
+	github.com/google/uuid v1.6.0
 	github.com/mattn/go-sqlite3 v1.14.22
+	github.com/mitchellh/go-wordwrap v1.0.1
 	github.com/rodaine/table v1.2.0
 	github.com/stretchr/testify v1.9.0
 	go.starlark.net v0.0.0-20240520160348-046347dcd104
@@ -13,10 +15,8 @@ require (
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/google/uuid v1.6.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
-	github.com/mitchellh/go-wordwrap v1.0.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/sys v0.18.0 // indirect
 )
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"clan/pkg/llm"
+	"clan/pkg/planning"
+	"clan/pkg/workflow"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// event is a line written by --output jsonl. Only the fields relevant to its
+// type are set.
+type event struct {
+	Type       string                 `json:"type"`
+	Time       time.Time              `json:"time"`
+	WorkflowID string                 `json:"workflow_id"`
+	Resumed    bool                   `json:"resumed,omitempty"`
+	Node       string                 `json:"node,omitempty"`
+	Agent      string                 `json:"agent,omitempty"`
+	Text       string                 `json:"text,omitempty"`
+	Tool       string                 `json:"tool,omitempty"`
+	ToolUseID  string                 `json:"tool_use_id,omitempty"`
+	Input      map[string]interface{} `json:"input,omitempty"`
+	Result     string                 `json:"result,omitempty"`
+	IsError    bool                   `json:"is_error,omitempty"`
+	Plan       []planTask             `json:"plan,omitempty"`
+	NextAgent  string                 `json:"next_agent,omitempty"`
+	Human      string                 `json:"human,omitempty"`
+	Summary    string                 `json:"summary,omitempty"`
+	Command    string                 `json:"command,omitempty"`
+	Approved   *bool                  `json:"approved,omitempty"`
+	Usage      *eventUsage            `json:"usage,omitempty"`
+	Reason     string                 `json:"reason,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+type planTask struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Owner       string `json:"owner"`
+	Status      string `json:"status"`
+}
+
+type eventUsage struct {
+	llm.Usage
+	Calls     int     `json:"calls"`
+	Cost      float64 `json:"cost"`
+	ToolCalls int     `json:"tool_calls"`
+	Duration  float64 `json:"duration_seconds"`
+}
+
+// renderJSONL writes one event per line to stdout. Approvals and answers are
+// asked on stderr and read from stdin.
+func renderJSONL(ctx context.Context, events <-chan workflow.Event, workflowID string, resumed bool, opts *options) {
+	encoder := json.NewEncoder(os.Stdout)
+	emit := func(e event) {
+		e.Time = time.Now().UTC()
+		e.WorkflowID = workflowID
+		err := encoder.Encode(e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: unable to write event: %s\n", err)
+		}
+	}
+
+	emit(event{Type: "run_started", Resumed: resumed})
+
+	for ev := range events {
+		switch e := ev.(type) {
+		case workflow.NodeStarted:
+			emit(event{Type: "node_entered", Node: e.Node, Agent: e.Agent})
+		case workflow.ModelResponded:
+			text := e.Text()
+			if text != "" {
+				emit(event{Type: "model_text", Agent: e.Agent, Text: text})
+			}
+		case workflow.ToolCalled:
+			emit(event{Type: "tool_call", Agent: e.Agent, Tool: e.Tool, ToolUseID: e.ToolUseID, Input: e.Input})
+		case workflow.ToolReturned:
+			emit(event{Type: "tool_result", Agent: e.Agent, Tool: e.Tool, ToolUseID: e.ToolUseID, Result: e.Result, IsError: e.IsError})
+		case workflow.ApprovalRequested:
+			emit(event{Type: "approval_requested", Agent: e.Agent, Tool: e.Tool, Command: e.Command})
+			approval := approve(ctx, e, os.Stderr)
+			e.Respond(approval)
+			command := e.Command
+			if approval.Command != "" {
+				command = approval.Command
+			}
+			emit(event{Type: "approval_answered", Agent: e.Agent, Tool: e.Tool, Command: command, Approved: &approval.Approved, Reason: approval.Reason})
+		case workflow.InputRequested:
+			emit(event{Type: "input_requested", Agent: e.Agent, Human: e.Human, ToolUseID: e.ToolUseID, Text: e.Question})
+			answer, ok := askInput(ctx, e, os.Stderr, opts)
+			if !ok {
+				e.Postpone()
+				continue
+			}
+			e.Answer(answer)
+			emit(event{Type: "input_answered", Agent: e.Agent, Human: e.Human, Text: answer})
+		case workflow.PlanUpdated:
+			emit(event{Type: "plan_changed", Agent: e.Agent, Plan: planTasks(e.Plan)})
+		case workflow.Handover:
+			emit(event{Type: "handover", Agent: e.From, NextAgent: e.To, Summary: e.Summary})
+		case workflow.RunCompleted:
+			emit(event{Type: "run_finished", Usage: newEventUsage(e.State.TotalUsage)})
+		case workflow.RunFailed:
+			emit(event{Type: "run_failed", Reason: string(e.Reason), Error: e.Err.Error(), Usage: newEventUsage(e.State.TotalUsage)})
+		}
+	}
+}
+
+func newEventUsage(us workflow.UsageSummary) *eventUsage {
+	return &eventUsage{
+		Usage:     us.Usage,
+		Calls:     us.Calls,
+		Cost:      us.Cost,
+		ToolCalls: us.ToolCalls,
+		Duration:  us.Duration.Seconds(),
+	}
+}
+
+func planTasks(plan []planning.Task) []planTask {
+	tasks := []planTask{}
+	for _, task := range plan {
+		tasks = append(tasks, planTask{Name: task.Name, Description: task.Description, Owner: task.Owner, Status: task.Status})
+	}
+	return tasks
+}
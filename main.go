@@ -1,97 +1,121 @@
 package main
 
 import (
-	"clan/pkg/clan"
-	"clan/pkg/workflow"
-	"crypto/sha1"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
-
-	"github.com/fatih/color"
-	"github.com/google/uuid"
-	"github.com/mitchellh/go-wordwrap"
-	"github.com/rodaine/table"
-	"gopkg.in/yaml.v3"
+	"os/signal"
+	"syscall"
 )
 
-func main() {
-	workflowPath := os.Args[1]
-	if workflowPath == "" {
-		fmt.Fprintf(os.Stderr, "Please pass a path for your Clan workflow definition\n")
-		os.Exit(-1)
-	}
+const usage = `Usage: clan <command> [flags] [arguments]
 
-	def, err := parseWorkflow(workflowPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to parse your workflow definition: %s\n", err)
-		os.Exit(-1)
-	}
+Commands:
+  run <manifest>                        Run a workflow
+  resume <workflow-id> <manifest>       Resume a workflow from its last checkpoint
+  validate <manifest>                   Check a manifest for errors
+  runs list [<manifest>]                List the runs stored by the checkpointer
+  runs show <workflow-id> [<manifest>]  Show the checkpoints and result of a run
+  runs state <workflow-id> <manifest>   Print the state a run resumes with as JSON
+  runs edit <workflow-id> <manifest>    Change the state and node a run resumes with
+  graph <manifest>                      Print the workflow as a Mermaid flowchart
+  tools list [<manifest>]               List the tools available to agents
+  schema                                Print the JSON Schema of manifests
 
-	workflowID := uuid.New()
-	sChan, err := workflow.Execute(def, workflowID.String())
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to execute your workflow: %s\n", err)
-		os.Exit(-1)
-	}
+Run 'clan <command> -h' to see the flags of a command.
+`
 
-	oldPlanHash := ""
-	planHash := ""
-	for element := range sChan {
-		res := element.(clan.StreamState[workflow.WorkflowState])
-		if res.State.CurrentAgent == "" {
-			continue
-		}
-		agentColor := color.New(color.Bold).SprintFunc()
-		fmt.Printf(color.BlueString("AGENT NAME: ")+agentColor(" %s\n"), res.State.CurrentAgent)
-		history := res.State.AgentHistory[res.State.CurrentAgent]
-		if len(history) > 0 {
-			// fmt.Printf("LAST MESSAGE FROM AGENT HISTORY IS:  %+v\n", history[len(history)-1])
-			for _, c := range history[len(history)-1].Content {
-				switch c.ContentType {
-				case "text":
-					fmt.Printf("%s\n", c.Text)
-				case "tool_use":
-					fmt.Printf(color.YellowString("CALLING TOOL: %s\n"), c.Name)
-				case "tool_result":
-					fmt.Printf(color.CyanString("TOOL RESULT: \n%s\n", c.Content))
-				}
-			}
-		}
+// usageError is returned when a command is called with invalid arguments
+type usageError struct {
+	msg string
+}
 
-		pHash := sha1.New()
-		for _, task := range res.State.Plan {
-			taskString := fmt.Sprintf("%s-%s-%s-%s", task.Name, task.Description, task.Owner, task.Status)
-			pHash.Write([]byte(taskString))
-		}
+func (e *usageError) Error() string {
+	return e.msg
+}
 
-		oldPlanHash = planHash
-		planHash = fmt.Sprintf("%x", pHash.Sum([]byte{}))
-		if planHash != oldPlanHash && len(res.State.Plan) > 0 {
-			fmt.Println(agentColor("Plan"))
-			headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
-			columnFmt := color.New(color.FgYellow).SprintfFunc()
-			tbl := table.New("Name", "Description", "Owner", "Status")
-			tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
-			for _, task := range res.State.Plan {
-				tbl.AddRow(task.Name, wordwrap.WrapString(task.Description, 100), task.Owner, task.Status)
-			}
-			tbl.Print()
-		}
+// exitError is returned when a command has already reported why it failed
+// and only the exit status remains to be set
+type exitError struct {
+	code int
+}
 
-	}
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
 }
 
-func parseWorkflow(workflowPath string) (*workflow.WorkflowDefinition, error) {
-	workflowBytes, err := os.ReadFile(workflowPath)
-	if err != nil {
-		return nil, err
+func main() {
+	// The first interrupt stops the run at its last checkpoint, a second one
+	// exits immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := dispatch(ctx, os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+
+	var ee *exitError
+	if errors.As(err, &ee) {
+		os.Exit(ee.code)
+	}
+
+	var ue *usageError
+	if errors.As(err, &ue) {
+		fmt.Fprintf(os.Stderr, "%s\n\n%s", ue.msg, usage)
+		os.Exit(2)
 	}
 
-	wd := workflow.WorkflowDefinition{}
-	err = yaml.Unmarshal(workflowBytes, &wd)
 	if err != nil {
-		return nil, err
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
 	}
+}
 
-	return &wd, nil
+func dispatch(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return &usageError{msg: "Please specify a command"}
+	}
+
+	switch args[0] {
+	case "run":
+		return runCommand(ctx, args[1:])
+	case "resume":
+		return resumeCommand(ctx, args[1:])
+	case "validate":
+		return validateCommand(args[1:])
+	case "graph":
+		return graphCommand(args[1:])
+	case "runs":
+		if len(args) > 1 && args[1] == "list" {
+			return runsListCommand(args[2:])
+		}
+		if len(args) > 1 && args[1] == "show" {
+			return runsShowCommand(args[2:])
+		}
+		if len(args) > 1 && args[1] == "state" {
+			return runsStateCommand(args[2:])
+		}
+		if len(args) > 1 && args[1] == "edit" {
+			return runsEditCommand(args[2:])
+		}
+		return &usageError{msg: "Please specify 'runs list', 'runs show', 'runs state' or 'runs edit'"}
+	case "tools":
+		if len(args) > 1 && args[1] == "list" {
+			return toolsListCommand(args[2:])
+		}
+		return &usageError{msg: "Please specify 'tools list'"}
+	case "schema":
+		return schemaCommand(args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return nil
+	default:
+		return &usageError{msg: fmt.Sprintf("Unknown command %s", args[0])}
+	}
 }
@@ -1,17 +1,33 @@
 package checkpointer
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type Checkpointer interface {
 	Checkpoint(workflowID string, checkpoint Checkpoint) error
 	GetLastCheckpoint(workflowID string) (*Checkpoint, error)
 	ListAll(workflowID string) ([]Checkpoint, error)
+	// ListWorkflows returns a summary of every workflow with checkpoints,
+	// most recently updated first
+	ListWorkflows() ([]WorkflowSummary, error)
 }
 
 type Checkpoint struct {
 	NodeName     string
 	State        string
 	CurrentDepth int
+	// Timestamp is set by the checkpointer when the checkpoint is stored
+	Timestamp time.Time
+}
+
+type WorkflowSummary struct {
+	WorkflowID string
+	// LastCheckpoint is the most recent checkpoint of the workflow
+	LastCheckpoint Checkpoint
+	Checkpoints    int
+	StartedAt      time.Time
 }
 
 func NewCheckpointerWithName(checkpointerType string, connectionString string) (Checkpointer, error) {
@@ -68,17 +68,17 @@ func (s *sqlite) GetLastCheckpoint(workflowID string) (*Checkpoint, error) {
 	}
 
 	row := s.db.QueryRow(`
-		SELECT node_name, state, depth FROM 
+		SELECT node_name, state, depth, timestamp FROM 
 		checkpoints WHERE workflow_id = $1
-		ORDER BY timestamp DESC LIMIT 1
+		ORDER BY id DESC LIMIT 1
 	`, workflowID)
 
 	if row.Err() != nil {
-		return nil, err
+		return nil, row.Err()
 	}
 
 	var cp Checkpoint
-	err = row.Scan(&cp.NodeName, &cp.State, &cp.CurrentDepth)
+	err = row.Scan(&cp.NodeName, &cp.State, &cp.CurrentDepth, &cp.Timestamp)
 	if err != nil {
 		return nil, err
 	}
@@ -93,9 +93,9 @@ func (s *sqlite) ListAll(workflowID string) ([]Checkpoint, error) {
 	}
 
 	rows, err := s.db.Query(`
-		SELECT node_name, state, depth FROM 
+		SELECT node_name, state, depth, timestamp FROM 
 		checkpoints WHERE workflow_id = $1
-		ORDER BY timestamp
+		ORDER BY id
 	`, workflowID)
 	if err != nil {
 		return nil, err
@@ -104,11 +104,46 @@ func (s *sqlite) ListAll(workflowID string) ([]Checkpoint, error) {
 	var result []Checkpoint
 	for rows.Next() {
 		var cp Checkpoint
-		err := rows.Scan(&cp.NodeName, &cp.State, &cp.CurrentDepth)
+		err := rows.Scan(&cp.NodeName, &cp.State, &cp.CurrentDepth, &cp.Timestamp)
 		if err != nil {
 			return nil, err
 		}
 		result = append(result, cp)
 	}
-	return result, nil
+	return result, rows.Err()
+}
+
+func (s *sqlite) ListWorkflows() ([]WorkflowSummary, error) {
+	err := s.setup()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT w.workflow_id, w.checkpoints, last.node_name, last.state, last.depth,
+			last.timestamp, first.timestamp
+		FROM (
+			SELECT workflow_id, MIN(id) AS first_id, MAX(id) AS last_id, COUNT(*) AS checkpoints
+			FROM checkpoints GROUP BY workflow_id
+		) w
+		JOIN checkpoints last ON last.id = w.last_id
+		JOIN checkpoints first ON first.id = w.first_id
+		ORDER BY w.last_id DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []WorkflowSummary
+	for rows.Next() {
+		var ws WorkflowSummary
+		cp := &ws.LastCheckpoint
+		err := rows.Scan(&ws.WorkflowID, &ws.Checkpoints, &cp.NodeName, &cp.State, &cp.CurrentDepth, &cp.Timestamp, &ws.StartedAt)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, ws)
+	}
+	return result, rows.Err()
 }
@@ -98,3 +98,31 @@ func TestSQLiteListAllCheckpoints(t *testing.T) {
 	require.Equal(t, 2, checkpoints[1].CurrentDepth)
 
 }
+
+func TestSQLiteListWorkflows(t *testing.T) {
+	filepath := "./test_database.db"
+	db, err := NewSQLite(filepath)
+	require.NoError(t, err)
+	defer func() {
+		err = os.Remove(filepath)
+		require.NoError(t, err)
+	}()
+
+	require.NoError(t, db.Checkpoint("first", Checkpoint{NodeName: "Programmer", State: "{}", CurrentDepth: 0}))
+	require.NoError(t, db.Checkpoint("first", Checkpoint{NodeName: "Reviewer", State: "{}", CurrentDepth: 1}))
+	require.NoError(t, db.Checkpoint("second", Checkpoint{NodeName: "Planner", State: "{}", CurrentDepth: 0}))
+
+	workflows, err := db.ListWorkflows()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(workflows))
+
+	require.Equal(t, "second", workflows[0].WorkflowID)
+	require.Equal(t, 1, workflows[0].Checkpoints)
+
+	require.Equal(t, "first", workflows[1].WorkflowID)
+	require.Equal(t, 2, workflows[1].Checkpoints)
+	require.Equal(t, "Reviewer", workflows[1].LastCheckpoint.NodeName)
+	require.Equal(t, 1, workflows[1].LastCheckpoint.CurrentDepth)
+	require.False(t, workflows[1].StartedAt.IsZero())
+	require.False(t, workflows[1].LastCheckpoint.Timestamp.Before(workflows[1].StartedAt))
+}
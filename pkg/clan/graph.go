@@ -0,0 +1,244 @@
+package clan
+
+import (
+	"clan/pkg/checkpointer"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// End is a special node name that indicates the workflow can end
+const End = "End"
+
+var (
+	NodeNotFoundErr           = errors.New("node not found")
+	StartNodeNotSetErr        = errors.New("start node not set")
+	NoEdgeErr                 = errors.New("no edge defined for node")
+	TraversalDepthExceededErr = errors.New("traversal depth exceeded")
+	InterruptedErr            = errors.New("interrupted")
+)
+
+type NodeFunc[T any] func(context.Context, *T) (*T, error)
+
+type ConditionalEdgeFunc[T any] func(*T) (string, error)
+
+type ClanGraph[T any] struct {
+	state            *T
+	nodes            map[string]NodeFunc[T]
+	edges            map[string]string
+	conditionalEdges map[string]ConditionalEdgeFunc[T]
+	startNode        string
+}
+
+type ExecuteOptions struct {
+	WorkflowID     string
+	StreamChannel  chan interface{}
+	TraversalDepth int
+	Checkpointer   checkpointer.Checkpointer
+
+	// StartNode and StartDepth resume execution from a previously
+	// checkpointed position instead of the graph's start node
+	StartNode  string
+	StartDepth int
+
+	// InterruptBefore and InterruptAfter are the nodes to stop at with
+	// InterruptedErr, once the checkpoint of the node to resume from has been
+	// written. A run resumed from a node it was interrupted before runs it.
+	InterruptBefore []string
+	InterruptAfter  []string
+}
+
+// StreamState is sent on the stream channel after every node. State is a
+// deep copy of the state so that it can be read while the graph continues.
+type StreamState[T any] struct {
+	NodeName string
+	State    T
+}
+
+func NewClanGraph[T any](initialState *T) *ClanGraph[T] {
+	return &ClanGraph[T]{
+		state:            initialState,
+		nodes:            make(map[string]NodeFunc[T]),
+		edges:            make(map[string]string),
+		conditionalEdges: make(map[string]ConditionalEdgeFunc[T]),
+	}
+}
+
+func (g *ClanGraph[T]) AddNode(name string, fn NodeFunc[T]) {
+	g.nodes[name] = fn
+}
+
+func (g *ClanGraph[T]) AddEdge(from string, to string) error {
+	if _, exists := g.nodes[from]; !exists {
+		return fmt.Errorf("%w: %s", NodeNotFoundErr, from)
+	}
+
+	if _, exists := g.nodes[to]; !exists && to != End {
+		return fmt.Errorf("%w: %s", NodeNotFoundErr, to)
+	}
+
+	g.edges[from] = to
+	return nil
+}
+
+func (g *ClanGraph[T]) AddConditionalEdge(from string, fn ConditionalEdgeFunc[T]) error {
+	if _, exists := g.nodes[from]; !exists {
+		return fmt.Errorf("%w: %s", NodeNotFoundErr, from)
+	}
+
+	g.conditionalEdges[from] = fn
+	return nil
+}
+
+func (g *ClanGraph[T]) SetStartNode(name string) error {
+	if _, exists := g.nodes[name]; !exists {
+		return fmt.Errorf("%w: %s", NodeNotFoundErr, name)
+	}
+
+	g.startNode = name
+	return nil
+}
+
+// Execute walks the graph from the start node until the End node is reached.
+// A checkpoint is written before every node runs so that an interrupted
+// execution can be resumed from the node that was about to run. When ctx is
+// cancelled the running node is abandoned and ctx's error is returned, the
+// last checkpoint then records the node to resume from. Nodes listed in
+// InterruptBefore or InterruptAfter stop the execution the same way.
+func (g *ClanGraph[T]) Execute(ctx context.Context, options ExecuteOptions) (*T, error) {
+	if options.StreamChannel != nil {
+		defer close(options.StreamChannel)
+	}
+
+	currentNode := g.startNode
+	if options.StartNode != "" {
+		currentNode = options.StartNode
+	}
+
+	if currentNode == "" {
+		return nil, StartNodeNotSetErr
+	}
+
+	state := g.state
+	depth := options.StartDepth
+	// The node a run is resumed from has already been interrupted before
+	resumed := options.StartNode != ""
+	interruptedAfter := ""
+	for currentNode != End {
+		node, exists := g.nodes[currentNode]
+		if !exists {
+			return state, fmt.Errorf("%w: %s", NodeNotFoundErr, currentNode)
+		}
+
+		err := g.checkpoint(options, currentNode, state, depth)
+		if err != nil {
+			return state, err
+		}
+
+		// The run resumes from currentNode without pausing before it again,
+		// so a pause before it is part of the pause after the previous node
+		if interruptedAfter != "" && slices.Contains(options.InterruptBefore, currentNode) {
+			return state, fmt.Errorf("%w after %s and before %s", InterruptedErr, interruptedAfter, currentNode)
+		}
+		if interruptedAfter != "" {
+			return state, fmt.Errorf("%w after %s", InterruptedErr, interruptedAfter)
+		}
+		if !resumed && slices.Contains(options.InterruptBefore, currentNode) {
+			return state, fmt.Errorf("%w before %s", InterruptedErr, currentNode)
+		}
+		resumed = false
+
+		if options.TraversalDepth > 0 && depth >= options.TraversalDepth {
+			return state, TraversalDepthExceededErr
+		}
+
+		if ctx.Err() != nil {
+			return state, ctx.Err()
+		}
+
+		nextState, err := node(ctx, state)
+		if ctx.Err() != nil {
+			// The node may have been interrupted half way through
+			return state, ctx.Err()
+		}
+		if err != nil {
+			return nextState, err
+		}
+		state = nextState
+		depth++
+
+		if options.StreamChannel != nil {
+			snapshot, err := copyState(state)
+			if err != nil {
+				return state, err
+			}
+			options.StreamChannel <- StreamState[T]{
+				NodeName: currentNode,
+				State:    *snapshot,
+			}
+		}
+
+		if slices.Contains(options.InterruptAfter, currentNode) {
+			interruptedAfter = currentNode
+		}
+
+		currentNode, err = g.nextNode(currentNode, state)
+		if err != nil {
+			return state, err
+		}
+	}
+
+	err := g.checkpoint(options, End, state, depth)
+	if err != nil {
+		return state, err
+	}
+
+	return state, nil
+}
+
+func (g *ClanGraph[T]) nextNode(currentNode string, state *T) (string, error) {
+	if fn, exists := g.conditionalEdges[currentNode]; exists {
+		return fn(state)
+	}
+
+	if next, exists := g.edges[currentNode]; exists {
+		return next, nil
+	}
+
+	return "", fmt.Errorf("%w: %s", NoEdgeErr, currentNode)
+}
+
+// copyState copies the state the same way it is stored in checkpoints
+func copyState[T any](state *T) (*T, error) {
+	stateBytes, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot T
+	err = json.Unmarshal(stateBytes, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+func (g *ClanGraph[T]) checkpoint(options ExecuteOptions, nodeName string, state *T, depth int) error {
+	if options.Checkpointer == nil {
+		return nil
+	}
+
+	stateBytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return options.Checkpointer.Checkpoint(options.WorkflowID, checkpointer.Checkpoint{
+		NodeName:     nodeName,
+		State:        string(stateBytes),
+		CurrentDepth: depth,
+	})
+}
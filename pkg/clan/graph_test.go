@@ -0,0 +1,280 @@
+package clan
+
+import (
+	"clan/pkg/checkpointer"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type emptyState struct{}
+
+type counterState struct {
+	Visited []string
+	Count   int
+}
+
+func TestExecuteStreamsNodes(t *testing.T) {
+	sc := make(chan interface{})
+
+	initialState := emptyState{}
+	eo := ExecuteOptions{WorkflowID: "sample", StreamChannel: sc}
+
+	graph := NewClanGraph(&initialState)
+	graph.AddNode("One", func(ctx context.Context, ws *emptyState) (*emptyState, error) {
+		return &emptyState{}, nil
+	})
+
+	graph.AddNode("Two", func(ctx context.Context, ws *emptyState) (*emptyState, error) {
+		return &emptyState{}, nil
+	})
+
+	require.NoError(t, graph.AddEdge("One", "Two"))
+	require.NoError(t, graph.AddEdge("Two", End))
+	require.NoError(t, graph.SetStartNode("One"))
+
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := graph.Execute(context.Background(), eo)
+		errChan <- err
+	}()
+
+	results := []string{}
+	for ss := range sc {
+		update := ss.(StreamState[emptyState])
+		results = append(results, update.NodeName)
+	}
+
+	require.NoError(t, <-errChan)
+	require.Equal(t, []string{"One", "Two"}, results)
+}
+
+func TestExecuteStreamsCopiesOfTheState(t *testing.T) {
+	sc := make(chan interface{})
+
+	initialState := counterState{}
+	graph := NewClanGraph(&initialState)
+	for _, name := range []string{"One", "Two"} {
+		graph.AddNode(name, func(ctx context.Context, cs *counterState) (*counterState, error) {
+			// Overwrite in place so that a shared backing array would show it
+			cs.Visited = append(cs.Visited[:0], name)
+			cs.Count++
+			return cs, nil
+		})
+	}
+	require.NoError(t, graph.AddEdge("One", "Two"))
+	require.NoError(t, graph.AddEdge("Two", End))
+	require.NoError(t, graph.SetStartNode("One"))
+
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := graph.Execute(context.Background(), ExecuteOptions{WorkflowID: "sample", StreamChannel: sc})
+		errChan <- err
+	}()
+
+	states := []counterState{}
+	for ss := range sc {
+		states = append(states, ss.(StreamState[counterState]).State)
+	}
+
+	require.NoError(t, <-errChan)
+	require.Equal(t, []counterState{{Visited: []string{"One"}, Count: 1}, {Visited: []string{"Two"}, Count: 2}}, states)
+}
+
+func TestExecuteConditionalEdge(t *testing.T) {
+	graph := newCounterGraph(t)
+
+	state, err := graph.Execute(context.Background(), ExecuteOptions{WorkflowID: "sample"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Programmer", "Reviewer", "Programmer", "Reviewer"}, state.Visited)
+}
+
+func TestExecuteTraversalDepthExceeded(t *testing.T) {
+	graph := newCounterGraph(t)
+
+	state, err := graph.Execute(context.Background(), ExecuteOptions{WorkflowID: "sample", TraversalDepth: 3})
+	require.ErrorIs(t, err, TraversalDepthExceededErr)
+	require.Equal(t, 3, len(state.Visited))
+}
+
+func TestAddEdgeUnknownNode(t *testing.T) {
+	graph := NewClanGraph(&emptyState{})
+	graph.AddNode("One", func(ctx context.Context, ws *emptyState) (*emptyState, error) {
+		return ws, nil
+	})
+
+	require.ErrorIs(t, graph.AddEdge("One", "Two"), NodeNotFoundErr)
+	require.ErrorIs(t, graph.SetStartNode("Two"), NodeNotFoundErr)
+}
+
+func TestExecuteCheckpointsAndResumes(t *testing.T) {
+	cp, err := checkpointer.NewSQLite(filepath.Join(t.TempDir(), "test_database.db"))
+	require.NoError(t, err)
+
+	graph := newCounterGraph(t)
+	_, err = graph.Execute(context.Background(), ExecuteOptions{WorkflowID: "sample", Checkpointer: cp, TraversalDepth: 3})
+	require.ErrorIs(t, err, TraversalDepthExceededErr)
+
+	last, err := cp.GetLastCheckpoint("sample")
+	require.NoError(t, err)
+	require.Equal(t, "Reviewer", last.NodeName)
+	require.Equal(t, 3, last.CurrentDepth)
+	require.JSONEq(t, `{"Visited":["Programmer","Reviewer","Programmer"],"Count":3}`, last.State)
+
+	// Resume from the checkpoint with a fresh graph and restored state
+	resumed := newCounterGraph(t)
+	resumed.state.Visited = []string{"Programmer", "Reviewer", "Programmer"}
+	resumed.state.Count = 3
+	state, err := resumed.Execute(context.Background(), ExecuteOptions{
+		WorkflowID:   "sample",
+		Checkpointer: cp,
+		StartNode:    last.NodeName,
+		StartDepth:   last.CurrentDepth,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Programmer", "Reviewer", "Programmer", "Reviewer"}, state.Visited)
+
+	last, err = cp.GetLastCheckpoint("sample")
+	require.NoError(t, err)
+	require.Equal(t, End, last.NodeName)
+	require.Equal(t, 4, last.CurrentDepth)
+}
+
+func TestExecuteCancelledDuringNode(t *testing.T) {
+	cp, err := checkpointer.NewSQLite(filepath.Join(t.TempDir(), "test_database.db"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	graph := NewClanGraph(&counterState{})
+	graph.AddNode("Programmer", func(ctx context.Context, s *counterState) (*counterState, error) {
+		s.Count++
+		return s, nil
+	})
+	graph.AddNode("Reviewer", func(ctx context.Context, s *counterState) (*counterState, error) {
+		cancel()
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	require.NoError(t, graph.AddEdge("Programmer", "Reviewer"))
+	require.NoError(t, graph.AddEdge("Reviewer", End))
+	require.NoError(t, graph.SetStartNode("Programmer"))
+
+	_, err = graph.Execute(ctx, ExecuteOptions{WorkflowID: "sample", Checkpointer: cp})
+	require.ErrorIs(t, err, context.Canceled)
+
+	// The interrupted node is the one to resume from
+	last, err := cp.GetLastCheckpoint("sample")
+	require.NoError(t, err)
+	require.Equal(t, "Reviewer", last.NodeName)
+	require.Equal(t, 1, last.CurrentDepth)
+	require.JSONEq(t, `{"Visited":null,"Count":1}`, last.State)
+}
+
+func TestExecuteInterruptsBeforeNodes(t *testing.T) {
+	cp, err := checkpointer.NewSQLite(filepath.Join(t.TempDir(), "test_database.db"))
+	require.NoError(t, err)
+
+	graph := newCounterGraph(t)
+	state, err := graph.Execute(context.Background(), ExecuteOptions{WorkflowID: "sample", Checkpointer: cp, InterruptBefore: []string{"Reviewer"}})
+	require.ErrorIs(t, err, InterruptedErr)
+	require.EqualError(t, err, "interrupted before Reviewer")
+	require.Equal(t, []string{"Programmer"}, state.Visited)
+
+	last, err := cp.GetLastCheckpoint("sample")
+	require.NoError(t, err)
+	require.Equal(t, "Reviewer", last.NodeName)
+	require.Equal(t, 1, last.CurrentDepth)
+
+	// The resumed run runs Reviewer and stops the next time it is reached
+	state, err = graph.Execute(context.Background(), ExecuteOptions{
+		WorkflowID:      "sample",
+		Checkpointer:    cp,
+		StartNode:       last.NodeName,
+		StartDepth:      last.CurrentDepth,
+		InterruptBefore: []string{"Reviewer"},
+	})
+	require.ErrorIs(t, err, InterruptedErr)
+	require.Equal(t, []string{"Programmer", "Reviewer", "Programmer"}, state.Visited)
+}
+
+func TestExecuteInterruptsAfterNodes(t *testing.T) {
+	cp, err := checkpointer.NewSQLite(filepath.Join(t.TempDir(), "test_database.db"))
+	require.NoError(t, err)
+
+	graph := newCounterGraph(t)
+	state, err := graph.Execute(context.Background(), ExecuteOptions{WorkflowID: "sample", Checkpointer: cp, InterruptAfter: []string{"Reviewer"}})
+	require.EqualError(t, err, "interrupted after Reviewer")
+	require.Equal(t, []string{"Programmer", "Reviewer"}, state.Visited)
+
+	// The checkpoint records the state after Reviewer and the node it chose
+	last, err := cp.GetLastCheckpoint("sample")
+	require.NoError(t, err)
+	require.Equal(t, "Programmer", last.NodeName)
+	require.Equal(t, 2, last.CurrentDepth)
+	require.JSONEq(t, `{"Visited":["Programmer","Reviewer"],"Count":2}`, last.State)
+
+	// Nodes followed by End complete the run
+	state, err = graph.Execute(context.Background(), ExecuteOptions{
+		WorkflowID:     "sample",
+		Checkpointer:   cp,
+		StartNode:      last.NodeName,
+		StartDepth:     last.CurrentDepth,
+		InterruptAfter: []string{"Reviewer"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Programmer", "Reviewer", "Programmer", "Reviewer"}, state.Visited)
+}
+
+func TestExecuteInterruptsAfterAndBeforeTheNextNode(t *testing.T) {
+	cp, err := checkpointer.NewSQLite(filepath.Join(t.TempDir(), "test_database.db"))
+	require.NoError(t, err)
+
+	graph := newCounterGraph(t)
+	options := ExecuteOptions{WorkflowID: "sample", Checkpointer: cp, InterruptAfter: []string{"Programmer"}, InterruptBefore: []string{"Reviewer"}}
+	state, err := graph.Execute(context.Background(), options)
+	require.ErrorIs(t, err, InterruptedErr)
+	require.EqualError(t, err, "interrupted after Programmer and before Reviewer")
+	require.Equal(t, []string{"Programmer"}, state.Visited)
+
+	last, err := cp.GetLastCheckpoint("sample")
+	require.NoError(t, err)
+	require.Equal(t, "Reviewer", last.NodeName)
+
+	// Both interrupts have paused the run, which resumes with Reviewer and
+	// stops after Programmer runs again
+	options.StartNode = last.NodeName
+	options.StartDepth = last.CurrentDepth
+	state, err = graph.Execute(context.Background(), options)
+	require.EqualError(t, err, "interrupted after Programmer and before Reviewer")
+	require.Equal(t, []string{"Programmer", "Reviewer", "Programmer"}, state.Visited)
+}
+
+func newCounterGraph(t *testing.T) *ClanGraph[counterState] {
+	graph := NewClanGraph(&counterState{})
+	graph.AddNode("Programmer", func(ctx context.Context, s *counterState) (*counterState, error) {
+		s.Visited = append(s.Visited, "Programmer")
+		s.Count++
+		return s, nil
+	})
+
+	graph.AddNode("Reviewer", func(ctx context.Context, s *counterState) (*counterState, error) {
+		s.Visited = append(s.Visited, "Reviewer")
+		s.Count++
+		return s, nil
+	})
+
+	require.NoError(t, graph.AddEdge("Programmer", "Reviewer"))
+	require.NoError(t, graph.AddConditionalEdge("Reviewer", func(s *counterState) (string, error) {
+		if s.Count < 4 {
+			return "Programmer", nil
+		}
+		return End, nil
+	}))
+	require.NoError(t, graph.SetStartNode("Programmer"))
+
+	return graph
+}
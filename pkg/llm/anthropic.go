@@ -2,11 +2,12 @@ package llm
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
+	"time"
 )
 
 type Anthropic struct {
@@ -14,6 +15,19 @@ type Anthropic struct {
 	baseURL string
 	model   string
 	tools   []Tool
+
+	temperature   *float32
+	topP          *float32
+	topK          *int
+	maxTokens     int
+	stopSequences []string
+
+	client *http.Client
+	// streamClient only bounds the wait for the response headers, streams
+	// are read until ctx is done
+	streamClient *http.Client
+	retry        RetryOptions
+	limiter      *Limiter
 }
 
 type AnthropicOptions struct {
@@ -21,6 +35,19 @@ type AnthropicOptions struct {
 	BaseURL string
 	Model   string
 	Tools   []Tool
+
+	Temperature   *float32
+	TopP          *float32
+	TopK          *int
+	MaxTokens     int
+	StopSequences []string
+
+	// Timeout bounds a single request, zero uses DefaultTimeout. Streamed
+	// requests must receive the response headers within Timeout.
+	Timeout    time.Duration
+	MaxRetries int
+	// Limiter is shared with other models using the same provider
+	Limiter *Limiter
 }
 
 func NewAnthropic(options *AnthropicOptions) *Anthropic {
@@ -34,74 +61,62 @@ func NewAnthropic(options *AnthropicOptions) *Anthropic {
 	}
 
 	if options.Model == "" {
-		options.Model = "claude-3-haiku-20240307"
+		options.Model = DefaultModels["anthropic"]
 	}
 
 	if options.Tools == nil {
 		options.Tools = []Tool{}
 	}
 
+	if options.MaxTokens == 0 {
+		options.MaxTokens = 4096
+	}
+
+	if options.Timeout == 0 {
+		options.Timeout = DefaultTimeout
+	}
+
 	return &Anthropic{
 		apiKey:  options.APIKey,
 		baseURL: options.BaseURL,
 		model:   options.Model,
 		tools:   options.Tools,
-	}
-}
-
-func (a *Anthropic) Generate(messages []Message) ([]Message, error) {
 
-	systemMessage := ""
-	var cleansedMessages []Message
-	for _, sm := range messages {
-		if sm.Role == "system" {
-			systemMessage += sm.Content[0].Text
-			continue
-		}
+		temperature:   options.Temperature,
+		topP:          options.TopP,
+		topK:          options.TopK,
+		maxTokens:     options.MaxTokens,
+		stopSequences: options.StopSequences,
 
-		cleansedMessages = append(cleansedMessages, sm)
+		client:       &http.Client{Timeout: options.Timeout},
+		streamClient: &http.Client{Transport: headerTimeoutTransport(options.Timeout)},
+		retry:        RetryOptions{MaxRetries: options.MaxRetries},
+		limiter:      options.Limiter,
 	}
+}
 
-	rb := anthropicReqBody{
-		MaxTokens: 4096,
-		Model:     a.model,
-		Messages:  cleansedMessages,
-		System:    systemMessage,
-		Tools:     a.tools,
-	}
+// headerTimeoutTransport is the default transport with a limit on the time
+// waited for the response headers, which unlike http.Client.Timeout does
+// not cut off the body while it is being read
+func headerTimeoutTransport(timeout time.Duration) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+	return transport
+}
 
-	rbBytes, err := json.Marshal(rb)
+func (a *Anthropic) Generate(ctx context.Context, messages []Message) (*Response, error) {
+	rbBytes, err := json.Marshal(a.requestBody(messages, false))
 	if err != nil {
 		return nil, err
 	}
 
-	bufferedReq := bytes.NewBuffer(rbBytes)
 	// log.Printf("Request to Anthropic is: %+v", string(rbBytes))
 
-	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/messages", a.baseURL), bufferedReq)
+	respBytes, err := doWithRetry(ctx, "Anthropic", a.client, a.limiter, a.retry, a.newRequest(ctx, rbBytes))
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Add("x-api-key", a.apiKey)
-	req.Header.Add("anthropic-version", "2023-06-01")
-	req.Header.Add("content-type", "application/json")
-
-	client := http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	respBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("Error calling Anthropic %s", string(respBytes))
-	}
-
 	// log.Printf("Response from Anthropic %+v", string(respBytes))
 
 	ar := anthropicResponse{}
@@ -116,22 +131,78 @@ func (a *Anthropic) Generate(messages []Message) ([]Message, error) {
 		Content: ar.Content,
 	})
 
-	return result, nil
+	model := ar.Model
+	if model == "" {
+		model = a.model
+	}
+
+	return &Response{Messages: result, Usage: ar.Usage, Model: model}, nil
+}
+
+func (a *Anthropic) requestBody(messages []Message, stream bool) anthropicReqBody {
+	systemMessage := ""
+	var cleansedMessages []Message
+	for _, sm := range messages {
+		if sm.Role == "system" {
+			systemMessage += sm.Content[0].Text
+			continue
+		}
+
+		// Anthropic rejects fields it does not know
+		content := make([]Content, len(sm.Content))
+		for i, c := range sm.Content {
+			c.RawInput = ""
+			content[i] = c
+		}
+		cleansedMessages = append(cleansedMessages, Message{Role: sm.Role, Content: content})
+	}
+
+	return anthropicReqBody{
+		MaxTokens:     a.maxTokens,
+		Model:         a.model,
+		Messages:      cleansedMessages,
+		System:        systemMessage,
+		Tools:         a.tools,
+		Temperature:   a.temperature,
+		TopP:          a.topP,
+		TopK:          a.topK,
+		StopSequences: a.stopSequences,
+		Stream:        stream,
+	}
+}
+
+func (a *Anthropic) newRequest(ctx context.Context, rbBytes []byte) func() (*http.Request, error) {
+	return func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/messages", a.baseURL), bytes.NewBuffer(rbBytes))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Add("x-api-key", a.apiKey)
+		req.Header.Add("anthropic-version", "2023-06-01")
+		req.Header.Add("content-type", "application/json")
+		return req, nil
+	}
 }
 
 type anthropicReqBody struct {
-	MaxTokens int       `json:"max_tokens"`
-	Messages  []Message `json:"messages"`
-	Model     string    `json:"model"`
-	System    string    `json:"system"`
-	Tools     []Tool    `json:"tools"`
+	MaxTokens     int       `json:"max_tokens"`
+	Messages      []Message `json:"messages"`
+	Model         string    `json:"model"`
+	System        string    `json:"system"`
+	Tools         []Tool    `json:"tools"`
+	Temperature   *float32  `json:"temperature,omitempty"`
+	TopP          *float32  `json:"top_p,omitempty"`
+	TopK          *int      `json:"top_k,omitempty"`
+	StopSequences []string  `json:"stop_sequences,omitempty"`
+	Stream        bool      `json:"stream,omitempty"`
 }
 
 type anthropicResponse struct {
-	Content []Content      `json:"content"`
-	Id      string         `json:"id"`
-	Model   string         `json:"model"`
-	Usage   map[string]int `json:"usage"`
+	Content []Content `json:"content"`
+	Id      string    `json:"id"`
+	Model   string    `json:"model"`
+	Usage   Usage     `json:"usage"`
 }
 
 // type anthropicResponseContent struct {
@@ -0,0 +1,196 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// GenerateStream sends the request with server-sent events enabled, calling
+// onDelta for every text and tool input fragment as it arrives. Error
+// statuses are retried when the stream is opened. Error events such as
+// overloaded_error and streams that end early are retried with the same
+// retry budget, unless a delta has already been passed to onDelta.
+func (a *Anthropic) GenerateStream(ctx context.Context, messages []Message, onDelta func(Delta)) (*Response, error) {
+	rbBytes, err := json.Marshal(a.requestBody(messages, true))
+	if err != nil {
+		return nil, err
+	}
+
+	retry := a.retry.withDefaults()
+	attempt := 0
+	for {
+		resp, err := openWithRetry(ctx, "Anthropic", a.streamClient, a.limiter, retry, &attempt, a.newRequest(ctx, rbBytes))
+		if err != nil {
+			return nil, err
+		}
+
+		streamed := false
+		result, err := a.stream(resp, func(d Delta) {
+			streamed = true
+			onDelta(d)
+		})
+
+		// Deltas that have been passed on cannot be taken back
+		var apiErr *APIError
+		if err == nil || streamed || ctx.Err() != nil || attempt >= retry.MaxRetries || !errors.As(err, &apiErr) || !apiErr.Retryable() {
+			return result, err
+		}
+
+		err = sleep(ctx, retry.backoff(attempt, 0))
+		if err != nil {
+			return nil, err
+		}
+		attempt++
+	}
+}
+
+// stream reads the events of a response
+func (a *Anthropic) stream(resp *http.Response, onDelta func(Delta)) (*Response, error) {
+	defer resp.Body.Close()
+
+	var content []Content
+	var partialJSON []strings.Builder
+	var usage Usage
+	model := a.model
+	stopped := false
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		event := anthropicStreamEvent{}
+		err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &event)
+		if err != nil {
+			return nil, err
+		}
+
+		switch event.Type {
+		case "message_start":
+			usage = event.Message.Usage
+			if event.Message.Model != "" {
+				model = event.Message.Model
+			}
+
+		case "message_delta":
+			// The output token count in message_delta is cumulative
+			usage.OutputTokens = event.Usage.OutputTokens
+
+		case "content_block_start":
+			block := event.ContentBlock
+			if block.ContentType == "tool_use" {
+				block.Input = nil
+			}
+			content = append(content, block)
+			partialJSON = append(partialJSON, strings.Builder{})
+			onDelta(Delta{
+				Index:       event.Index,
+				ContentType: block.ContentType,
+				Text:        block.Text,
+				Name:        block.Name,
+			})
+
+		case "content_block_delta":
+			if event.Index >= len(content) {
+				return nil, fmt.Errorf("Error calling Anthropic: delta for unknown content block %d", event.Index)
+			}
+
+			switch event.Delta.Type {
+			case "text_delta":
+				content[event.Index].Text += event.Delta.Text
+				onDelta(Delta{Index: event.Index, ContentType: "text", Text: event.Delta.Text})
+			case "input_json_delta":
+				partialJSON[event.Index].WriteString(event.Delta.PartialJSON)
+				onDelta(Delta{Index: event.Index, ContentType: "tool_use", PartialJSON: event.Delta.PartialJSON})
+			}
+
+		case "content_block_stop":
+			if event.Index >= len(content) || content[event.Index].ContentType != "tool_use" {
+				continue
+			}
+
+			content[event.Index].Input, content[event.Index].RawInput = parseToolInput(partialJSON[event.Index].String())
+
+		case "message_stop":
+			stopped = true
+
+		case "error":
+			return nil, newStreamError(event.Error.Type, event.Error.Message)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// A connection closed early would otherwise look like a short response
+	if !stopped {
+		return nil, newStreamError("incomplete_stream", "the stream ended before message_stop")
+	}
+
+	return &Response{
+		Messages: []Message{
+			{
+				Role:    "assistant",
+				Content: content,
+			},
+		},
+		Usage: usage,
+		Model: model,
+	}, nil
+}
+
+// newStreamError converts an error event received after the response has
+// started streaming into an *APIError
+func newStreamError(errType string, message string) *APIError {
+	apiErr := &APIError{
+		Provider:   "Anthropic",
+		StatusCode: http.StatusOK,
+		Type:       errType,
+		Message:    message,
+	}
+
+	switch errType {
+	case "overloaded_error":
+		apiErr.kind = OverloadedErr
+	case "rate_limit_error":
+		apiErr.kind = RateLimitedErr
+	case "authentication_error", "permission_error":
+		apiErr.kind = AuthenticationErr
+	case "invalid_request_error", "not_found_error", "request_too_large":
+		apiErr.kind = InvalidRequestErr
+	default:
+		apiErr.kind = ServerErr
+	}
+
+	return apiErr
+}
+
+type anthropicStreamEvent struct {
+	Type         string  `json:"type"`
+	Index        int     `json:"index"`
+	ContentBlock Content `json:"content_block"`
+	Message      struct {
+		Model string `json:"model"`
+		Usage Usage  `json:"usage"`
+	} `json:"message"`
+	Usage Usage `json:"usage"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
@@ -0,0 +1,238 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const anthropicStreamBody = `event: message_start
+data: {"type": "message_start", "message": {"id": "msg_1", "content": [], "usage": {"input_tokens": 25, "output_tokens": 1}}}
+
+event: content_block_start
+data: {"type": "content_block_start", "index": 0, "content_block": {"type": "text", "text": ""}}
+
+event: ping
+data: {"type": "ping"}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "Writing "}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "the file"}}
+
+event: content_block_stop
+data: {"type": "content_block_stop", "index": 0}
+
+event: content_block_start
+data: {"type": "content_block_start", "index": 1, "content_block": {"type": "tool_use", "id": "toolu_1", "name": "Writer", "input": {}}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 1, "delta": {"type": "input_json_delta", "partial_json": "{\"filepath\": \"ma"}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 1, "delta": {"type": "input_json_delta", "partial_json": "in.py\"}"}}
+
+event: content_block_stop
+data: {"type": "content_block_stop", "index": 1}
+
+event: message_delta
+data: {"type": "message_delta", "delta": {"stop_reason": "tool_use"}, "usage": {"output_tokens": 15}}
+
+event: message_stop
+data: {"type": "message_stop"}
+
+`
+
+func TestAnthropicGenerateStream(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &received))
+
+		w.Header().Set("content-type", "text/event-stream")
+		fmt.Fprint(w, anthropicStreamBody)
+	}))
+	defer server.Close()
+
+	model := NewAnthropic(&AnthropicOptions{BaseURL: server.URL})
+	var deltas []Delta
+	resp, err := model.GenerateStream(context.Background(), []Message{
+		{Role: "user", Content: []Content{{ContentType: "text", Text: "Write main.py"}}},
+	}, func(d Delta) {
+		deltas = append(deltas, d)
+	})
+	require.NoError(t, err)
+	require.Equal(t, true, received["stream"])
+
+	require.Equal(t, []Delta{
+		{Index: 0, ContentType: "text"},
+		{Index: 0, ContentType: "text", Text: "Writing "},
+		{Index: 0, ContentType: "text", Text: "the file"},
+		{Index: 1, ContentType: "tool_use", Name: "Writer"},
+		{Index: 1, ContentType: "tool_use", PartialJSON: `{"filepath": "ma`},
+		{Index: 1, ContentType: "tool_use", PartialJSON: `in.py"}`},
+	}, deltas)
+
+	require.Equal(t, 1, len(resp.Messages))
+	require.Equal(t, "assistant", resp.Messages[0].Role)
+	require.Equal(t, "Writing the file", resp.Messages[0].Content[0].Text)
+	require.Equal(t, "tool_use", resp.Messages[0].Content[1].ContentType)
+	require.Equal(t, "toolu_1", resp.Messages[0].Content[1].Id)
+	require.Equal(t, map[string]interface{}{"filepath": "main.py"}, resp.Messages[0].Content[1].Input)
+	require.Equal(t, Usage{InputTokens: 25, OutputTokens: 15}, resp.Usage)
+}
+
+func TestAnthropicGenerateStreamWithInvalidToolInput(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &received))
+
+		w.Header().Set("content-type", "text/event-stream")
+		fmt.Fprint(w, strings.Replace(anthropicStreamBody, `in.py\"}`, `in.py`, 1))
+	}))
+	defer server.Close()
+
+	model := NewAnthropic(&AnthropicOptions{BaseURL: server.URL})
+	resp, err := model.GenerateStream(context.Background(), []Message{
+		{Role: "assistant", Content: []Content{{ContentType: "tool_use", Id: "toolu_0", Name: "Reader", Input: map[string]interface{}{}, RawInput: "{"}}},
+	}, func(d Delta) {})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{}, resp.Messages[0].Content[1].Input)
+	require.Equal(t, `{"filepath": "main.py`, resp.Messages[0].Content[1].RawInput)
+
+	// The raw input is not sent to Anthropic
+	sent := received["messages"].([]interface{})[0].(map[string]interface{})["content"].([]interface{})[0].(map[string]interface{})
+	require.NotContains(t, sent, "raw_input")
+}
+
+func TestAnthropicGenerateStreamError(t *testing.T) {
+	stubSleep(t)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("content-type", "text/event-stream")
+		fmt.Fprint(w, "event: error\ndata: {\"type\": \"error\", \"error\": {\"type\": \"overloaded_error\", \"message\": \"Overloaded\"}}\n\n")
+	}))
+	defer server.Close()
+
+	model := NewAnthropic(&AnthropicOptions{BaseURL: server.URL})
+	_, err := model.GenerateStream(context.Background(), []Message{}, func(d Delta) {})
+	require.ErrorIs(t, err, OverloadedErr)
+	require.Equal(t, DefaultMaxRetries+1, calls)
+}
+
+func TestAnthropicGenerateStreamErrorStatus(t *testing.T) {
+	delays := stubSleep(t)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("retry-after", "7")
+		w.WriteHeader(529)
+		fmt.Fprint(w, `{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`)
+	}))
+	defer server.Close()
+
+	model := NewAnthropic(&AnthropicOptions{BaseURL: server.URL})
+	_, err := model.GenerateStream(context.Background(), []Message{}, func(d Delta) {})
+	require.ErrorIs(t, err, OverloadedErr)
+
+	// Error statuses are only retried when the stream is opened
+	require.Equal(t, DefaultMaxRetries+1, calls)
+	require.Equal(t, DefaultMaxRetries, len(*delays))
+	for _, d := range *delays {
+		require.Equal(t, 7*time.Second, d)
+	}
+}
+
+func TestAnthropicGenerateStreamSharesTheRetryBudget(t *testing.T) {
+	stubSleep(t)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls%2 == 1 {
+			w.WriteHeader(529)
+			return
+		}
+		w.Header().Set("content-type", "text/event-stream")
+		fmt.Fprint(w, "event: error\ndata: {\"type\": \"error\", \"error\": {\"type\": \"overloaded_error\", \"message\": \"Overloaded\"}}\n\n")
+	}))
+	defer server.Close()
+
+	model := NewAnthropic(&AnthropicOptions{BaseURL: server.URL})
+	_, err := model.GenerateStream(context.Background(), []Message{}, func(d Delta) {})
+	require.ErrorIs(t, err, OverloadedErr)
+	require.Equal(t, DefaultMaxRetries+1, calls)
+}
+
+func TestAnthropicGenerateStreamRetriesErrorEvents(t *testing.T) {
+	delays := stubSleep(t)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("content-type", "text/event-stream")
+		if calls == 1 {
+			fmt.Fprint(w, "event: error\ndata: {\"type\": \"error\", \"error\": {\"type\": \"overloaded_error\", \"message\": \"Overloaded\"}}\n\n")
+			return
+		}
+		fmt.Fprint(w, anthropicStreamBody)
+	}))
+	defer server.Close()
+
+	model := NewAnthropic(&AnthropicOptions{BaseURL: server.URL})
+	resp, err := model.GenerateStream(context.Background(), []Message{}, func(d Delta) {})
+	require.NoError(t, err)
+	require.Equal(t, "Writing the file", resp.Messages[0].Content[0].Text)
+	require.Equal(t, 2, calls)
+	require.Equal(t, 1, len(*delays))
+}
+
+func TestAnthropicGenerateStreamEndingEarly(t *testing.T) {
+	stubSleep(t)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("content-type", "text/event-stream")
+		fmt.Fprint(w, anthropicStreamBody[:strings.Index(anthropicStreamBody, "event: message_stop")])
+	}))
+	defer server.Close()
+
+	model := NewAnthropic(&AnthropicOptions{BaseURL: server.URL})
+	_, err := model.GenerateStream(context.Background(), []Message{}, func(d Delta) {})
+	require.ErrorIs(t, err, ServerErr)
+	require.ErrorContains(t, err, "the stream ended before message_stop")
+
+	// The deltas already received are not sent again
+	require.Equal(t, 1, calls)
+}
+
+func TestAnthropicStreamsLongerThanTheTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprint(w, anthropicStreamBody)
+	}))
+	defer server.Close()
+
+	model := NewAnthropic(&AnthropicOptions{BaseURL: server.URL, Timeout: 100 * time.Millisecond})
+	_, err := model.GenerateStream(context.Background(), []Message{}, func(d Delta) {})
+	require.NoError(t, err)
+}
@@ -0,0 +1,82 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnthropicGenerateSendsSamplingParameters(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/messages", r.URL.Path)
+		require.Equal(t, "test-key", r.Header.Get("x-api-key"))
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &received))
+
+		w.Write([]byte(`{"id": "msg_1", "content": [{"type": "text", "text": "Hello"}], "usage": {"input_tokens": 12, "output_tokens": 3, "cache_read_input_tokens": 100}}`))
+	}))
+	defer server.Close()
+
+	temperature := float32(0)
+	topP := float32(0.9)
+	topK := 40
+	model := NewAnthropic(&AnthropicOptions{
+		APIKey:        "test-key",
+		BaseURL:       server.URL,
+		Temperature:   &temperature,
+		TopP:          &topP,
+		TopK:          &topK,
+		MaxTokens:     1024,
+		StopSequences: []string{"</answer>"},
+	})
+
+	resp, err := model.Generate(context.Background(), []Message{
+		{Role: "system", Content: []Content{{ContentType: "text", Text: "Be brief"}}},
+		{Role: "user", Content: []Content{{ContentType: "text", Text: "Hi"}}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Hello", resp.Messages[0].Content[0].Text)
+	require.Equal(t, Usage{InputTokens: 12, OutputTokens: 3, CacheReadInputTokens: 100}, resp.Usage)
+
+	require.Equal(t, "Be brief", received["system"])
+	require.Equal(t, float64(1024), received["max_tokens"])
+	require.Equal(t, float64(0), received["temperature"])
+	require.InDelta(t, 0.9, received["top_p"], 0.0001)
+	require.Equal(t, float64(40), received["top_k"])
+	require.Equal(t, []interface{}{"</answer>"}, received["stop_sequences"])
+}
+
+func TestAnthropicGenerateDefaults(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &received))
+
+		w.Write([]byte(`{"id": "msg_1", "content": [{"type": "text", "text": "Hello"}]}`))
+	}))
+	defer server.Close()
+
+	model := NewAnthropic(&AnthropicOptions{BaseURL: server.URL})
+	resp, err := model.Generate(context.Background(), []Message{
+		{Role: "user", Content: []Content{{ContentType: "text", Text: "Hi"}}},
+	})
+	require.NoError(t, err)
+	// The requested model is reported when the response does not name one
+	require.Equal(t, "claude-3-haiku-20240307", resp.Model)
+
+	require.Equal(t, float64(4096), received["max_tokens"])
+	require.Equal(t, "claude-3-haiku-20240307", received["model"])
+	require.NotContains(t, received, "temperature")
+	require.NotContains(t, received, "top_p")
+	require.NotContains(t, received, "top_k")
+	require.NotContains(t, received, "stop_sequences")
+}
@@ -0,0 +1,280 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	CassetteRecord = "record"
+	CassetteReplay = "replay"
+)
+
+var CassetteMissErr = errors.New("no recorded response for request")
+
+// Cassette stores request and response pairs captured from a provider so
+// that a run can be replayed deterministically. A single cassette is shared
+// by all the agents in a workflow.
+type Cassette struct {
+	path         string
+	mode         string
+	interactions []CassetteInteraction
+	// replayed tracks which interactions have already been served so that
+	// identical requests are answered in the order they were recorded
+	replayed []bool
+	mu       sync.Mutex
+}
+
+type CassetteInteraction struct {
+	Key      string          `json:"key"`
+	Agent    string          `json:"agent"`
+	Request  CassetteRequest `json:"request"`
+	Response []Message       `json:"response"`
+	Usage    Usage           `json:"usage"`
+	Model    string          `json:"model,omitempty"`
+}
+
+type CassetteRequest struct {
+	Model    string    `json:"model"`
+	Tools    []Tool    `json:"tools"`
+	Messages []Message `json:"messages"`
+}
+
+type cassetteFile struct {
+	Interactions []CassetteInteraction `json:"interactions"`
+}
+
+// OpenCassette prepares a cassette for recording or loads a previously
+// recorded cassette for replay. Recording appends to the cassette at path
+// when it exists, so that a resumed run keeps the interactions recorded
+// before it was interrupted, and starts an empty file otherwise.
+func OpenCassette(path string, mode string) (*Cassette, error) {
+	c := &Cassette{
+		path: path,
+		mode: mode,
+	}
+
+	switch mode {
+	case CassetteRecord:
+		err := c.load()
+		if errors.Is(err, fs.ErrNotExist) {
+			c.interactions = []CassetteInteraction{}
+			return c, c.save()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	case CassetteReplay:
+		err := c.load()
+		if err != nil {
+			return nil, err
+		}
+
+		c.replayed = make([]bool, len(c.interactions))
+		return c, nil
+	default:
+		return nil, fmt.Errorf("invalid cassette mode %s", mode)
+	}
+}
+
+func (c *Cassette) load() error {
+	cassetteBytes, err := os.ReadFile(c.path)
+	if err != nil {
+		return err
+	}
+
+	cf := cassetteFile{}
+	err = json.Unmarshal(cassetteBytes, &cf)
+	if err != nil {
+		return fmt.Errorf("invalid cassette %s: %w", c.path, err)
+	}
+
+	c.interactions = cf.Interactions
+	return nil
+}
+
+func (c *Cassette) Mode() string {
+	return c.mode
+}
+
+// Wrap returns a model that records the traffic of model, or serves responses
+// from the cassette when replaying in which case model may be nil
+func (c *Cassette) Wrap(model LLM, options *ProviderOptions) LLM {
+	return &cassetteLLM{
+		cassette: c,
+		model:    model,
+		agent:    options.Agent,
+		name:     options.Model,
+		tools:    options.Tools,
+	}
+}
+
+type cassetteLLM struct {
+	cassette *Cassette
+	model    LLM
+	agent    string
+	name     string
+	tools    []Tool
+}
+
+func (cl *cassetteLLM) Generate(ctx context.Context, messages []Message) (*Response, error) {
+	return cl.generate(ctx, messages, nil)
+}
+
+// GenerateStream streams from the recorded model when it supports streaming.
+// Replayed responses are emitted as a single delta per content block.
+func (cl *cassetteLLM) GenerateStream(ctx context.Context, messages []Message, onDelta func(Delta)) (*Response, error) {
+	return cl.generate(ctx, messages, onDelta)
+}
+
+func (cl *cassetteLLM) generate(ctx context.Context, messages []Message, onDelta func(Delta)) (*Response, error) {
+	req := CassetteRequest{
+		Model:    cl.name,
+		Tools:    cl.tools,
+		Messages: messages,
+	}
+
+	key, err := req.Key()
+	if err != nil {
+		return nil, err
+	}
+
+	if cl.cassette.mode == CassetteReplay {
+		resp, err := cl.cassette.replay(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if onDelta != nil {
+			emitDeltas(resp.Messages, onDelta)
+		}
+		return resp, nil
+	}
+
+	var resp *Response
+	if streamer, ok := cl.model.(StreamingLLM); ok && onDelta != nil {
+		resp, err = streamer.GenerateStream(ctx, messages, onDelta)
+	} else {
+		resp, err = cl.model.Generate(ctx, messages)
+		if err == nil && onDelta != nil {
+			emitDeltas(resp.Messages, onDelta)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The workflow edits histories in place, so the recorded request is a
+	// copy taken at the time of the call
+	reqBytes, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	recordedReq := CassetteRequest{}
+	err = json.Unmarshal(reqBytes, &recordedReq)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cl.cassette.record(CassetteInteraction{
+		Key:      key,
+		Agent:    cl.agent,
+		Request:  recordedReq,
+		Response: resp.Messages,
+		Usage:    resp.Usage,
+		Model:    resp.Model,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// Key hashes the normalized request. Whitespace at the edges of text blocks
+// is ignored and empty content blocks are dropped.
+func (r CassetteRequest) Key() (string, error) {
+	normalized := CassetteRequest{
+		Model: r.Model,
+		Tools: r.Tools,
+	}
+
+	for _, m := range r.Messages {
+		nm := Message{Role: m.Role}
+		for _, c := range m.Content {
+			c.Text = strings.TrimSpace(c.Text)
+			c.Content = strings.TrimSpace(c.Content)
+			if c.ContentType == "text" && c.Text == "" && c.Content == "" {
+				continue
+			}
+			nm.Content = append(nm.Content, c)
+		}
+		normalized.Messages = append(normalized.Messages, nm)
+	}
+
+	reqBytes, err := json.Marshal(normalized)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(reqBytes)), nil
+}
+
+func (c *Cassette) replay(key string) (*Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, interaction := range c.interactions {
+		if interaction.Key == key && !c.replayed[i] {
+			c.replayed[i] = true
+			model := interaction.Model
+			if model == "" {
+				model = interaction.Request.Model
+			}
+			return &Response{Messages: interaction.Response, Usage: interaction.Usage, Model: model}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w %s in cassette %s", CassetteMissErr, key, c.path)
+}
+
+func (c *Cassette) record(interaction CassetteInteraction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interactions = append(c.interactions, interaction)
+	return c.save()
+}
+
+// save rewrites the whole cassette so that it is usable even when the run
+// that is being recorded does not complete
+func (c *Cassette) save() error {
+	cassetteBytes, err := json.MarshalIndent(cassetteFile{Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(c.path, cassetteBytes, 0644)
+}
+
+func emitDeltas(messages []Message, onDelta func(Delta)) {
+	for _, m := range messages {
+		for i, c := range m.Content {
+			switch c.ContentType {
+			case "text":
+				onDelta(Delta{Index: i, ContentType: "text", Text: c.Text})
+			case "tool_use":
+				inputBytes, _ := json.Marshal(c.Input)
+				onDelta(Delta{Index: i, ContentType: "tool_use", Name: c.Name, PartialJSON: string(inputBytes)})
+			}
+		}
+	}
+}
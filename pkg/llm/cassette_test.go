@@ -0,0 +1,84 @@
+package llm
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	cassettePath := filepath.Join(t.TempDir(), "run.cassette.json")
+	options := &ProviderOptions{Agent: "Programmer", Model: "echo-1"}
+
+	recorder, err := OpenCassette(cassettePath, CassetteRecord)
+	require.NoError(t, err)
+	model := recorder.Wrap(&echoLLM{model: "echo-1"}, options)
+
+	first := []Message{{Role: "user", Content: []Content{{ContentType: "text", Text: "Write a program"}}}}
+	second := []Message{{Role: "user", Content: []Content{{ContentType: "text", Text: "Review the program"}}}}
+	_, err = model.Generate(context.Background(), first)
+	require.NoError(t, err)
+	_, err = model.Generate(context.Background(), second)
+	require.NoError(t, err)
+
+	player, err := OpenCassette(cassettePath, CassetteReplay)
+	require.NoError(t, err)
+	replayed := player.Wrap(nil, options)
+
+	// Requests are matched by their normalized contents, not their order
+	resp, err := replayed.Generate(context.Background(), []Message{{Role: "user", Content: []Content{{ContentType: "text", Text: "  Review the program\n"}}}})
+	require.NoError(t, err)
+	require.Equal(t, "echo-1", resp.Messages[0].Content[0].Text)
+	require.Equal(t, Usage{InputTokens: 10, OutputTokens: 2}, resp.Usage)
+
+	_, err = replayed.Generate(context.Background(), first)
+	require.NoError(t, err)
+
+	// Each recorded response is only served once
+	_, err = replayed.Generate(context.Background(), first)
+	require.ErrorIs(t, err, CassetteMissErr)
+}
+
+func TestCassetteRecordingAppendsToExistingCassette(t *testing.T) {
+	cassettePath := filepath.Join(t.TempDir(), "run.cassette.json")
+	options := &ProviderOptions{Agent: "Programmer", Model: "echo-1"}
+	first := []Message{{Role: "user", Content: []Content{{ContentType: "text", Text: "Write a program"}}}}
+	second := []Message{{Role: "user", Content: []Content{{ContentType: "text", Text: "Review the program"}}}}
+
+	recorder, err := OpenCassette(cassettePath, CassetteRecord)
+	require.NoError(t, err)
+	_, err = recorder.Wrap(&echoLLM{model: "echo-1"}, options).Generate(context.Background(), first)
+	require.NoError(t, err)
+
+	// Recording a resumed run keeps what was recorded before
+	recorder, err = OpenCassette(cassettePath, CassetteRecord)
+	require.NoError(t, err)
+	_, err = recorder.Wrap(&echoLLM{model: "echo-1"}, options).Generate(context.Background(), second)
+	require.NoError(t, err)
+
+	player, err := OpenCassette(cassettePath, CassetteReplay)
+	require.NoError(t, err)
+	replayed := player.Wrap(nil, options)
+	_, err = replayed.Generate(context.Background(), first)
+	require.NoError(t, err)
+	_, err = replayed.Generate(context.Background(), second)
+	require.NoError(t, err)
+}
+
+func TestCassetteKeyIncludesModel(t *testing.T) {
+	messages := []Message{{Role: "user", Content: []Content{{ContentType: "text", Text: "Hi"}}}}
+
+	k1, err := CassetteRequest{Model: "one", Messages: messages}.Key()
+	require.NoError(t, err)
+	k2, err := CassetteRequest{Model: "two", Messages: messages}.Key()
+	require.NoError(t, err)
+
+	require.NotEqual(t, k1, k2)
+}
+
+func TestOpenCassetteInvalidMode(t *testing.T) {
+	_, err := OpenCassette(filepath.Join(t.TempDir(), "run.json"), "rewind")
+	require.Error(t, err)
+}
@@ -0,0 +1,96 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	RateLimitedErr    = errors.New("rate limited")
+	OverloadedErr     = errors.New("overloaded")
+	AuthenticationErr = errors.New("authentication failed")
+	InvalidRequestErr = errors.New("invalid request")
+	ServerErr         = errors.New("server error")
+)
+
+// APIError is returned when a provider responds with an error status. It
+// wraps one of the sentinel errors above so callers can use errors.Is.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Type       string
+	Message    string
+	RetryAfter time.Duration
+	kind       error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Error calling %s: %s (status %d): %s", e.Provider, e.kind, e.StatusCode, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// Retryable reports whether the request may succeed if it is sent again
+func (e *APIError) Retryable() bool {
+	return e.kind == RateLimitedErr || e.kind == OverloadedErr || e.kind == ServerErr
+}
+
+func newAPIError(provider string, resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Message:    string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("retry-after")),
+	}
+
+	// Both Anthropic and OpenAI describe errors as {"error": {"type", "message"}}
+	errBody := struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}{}
+	if json.Unmarshal(body, &errBody) == nil && errBody.Error.Message != "" {
+		apiErr.Type = errBody.Error.Type
+		apiErr.Message = errBody.Error.Message
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		apiErr.kind = RateLimitedErr
+	case resp.StatusCode == 529 || resp.StatusCode == http.StatusServiceUnavailable || apiErr.Type == "overloaded_error":
+		apiErr.kind = OverloadedErr
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		apiErr.kind = AuthenticationErr
+	case resp.StatusCode >= 500:
+		apiErr.kind = ServerErr
+	default:
+		apiErr.kind = InvalidRequestErr
+	}
+
+	return apiErr
+}
+
+// parseRetryAfter reads a retry-after header given either in seconds or as
+// an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
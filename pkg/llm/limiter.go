@@ -0,0 +1,92 @@
+package llm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter bounds the number of concurrent requests to a provider and the
+// rate at which they are sent using a token bucket. One limiter is shared
+// by all the agents that use the same provider.
+type Limiter struct {
+	slots chan struct{}
+
+	mu       sync.Mutex
+	tokens   float64
+	capacity float64
+	perSec   float64
+	last     time.Time
+}
+
+// NewLimiter creates a limiter. A maxConcurrency or requestsPerMinute of zero
+// leaves that dimension unlimited.
+func NewLimiter(maxConcurrency int, requestsPerMinute int) *Limiter {
+	l := &Limiter{}
+	if maxConcurrency > 0 {
+		l.slots = make(chan struct{}, maxConcurrency)
+	}
+
+	if requestsPerMinute > 0 {
+		l.capacity = float64(requestsPerMinute)
+		l.tokens = l.capacity
+		l.perSec = float64(requestsPerMinute) / 60
+		l.last = time.Now()
+	}
+
+	return l
+}
+
+// Acquire blocks until a request may be sent or ctx is cancelled. The
+// returned function must be called once the request has completed.
+func (l *Limiter) Acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	if l.perSec > 0 {
+		for {
+			wait := l.take()
+			if wait == 0 {
+				break
+			}
+			err := sleep(ctx, wait)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if l.slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return func() {
+		<-l.slots
+	}, nil
+}
+
+// take removes a token from the bucket or returns how long to wait for one
+func (l *Limiter) take() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.perSec
+	if l.tokens > l.capacity {
+		l.tokens = l.capacity
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - l.tokens) / l.perSec * float64(time.Second))
+}
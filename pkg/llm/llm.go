@@ -1,7 +1,59 @@
 package llm
 
+import "context"
+
+// LLM generates the next messages of a conversation. Implementations stop
+// waiting on the provider when ctx is cancelled.
 type LLM interface {
-	Generate([]Message) (Message, error)
+	Generate(ctx context.Context, messages []Message) (*Response, error)
+}
+
+// StreamingLLM is implemented by models that can report a response as it is
+// generated. onDelta is called for every increment before the complete
+// response is returned.
+type StreamingLLM interface {
+	LLM
+	GenerateStream(ctx context.Context, messages []Message, onDelta func(Delta)) (*Response, error)
+}
+
+// Response holds the messages generated by a model and the tokens consumed
+// to generate them
+type Response struct {
+	Messages []Message
+	Usage    Usage
+	// Model is the model that generated the response as reported by the
+	// provider, or the model requested when the provider does not report it
+	Model string
+}
+
+type Usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+func (u *Usage) Add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CacheCreationInputTokens += other.CacheCreationInputTokens
+	u.CacheReadInputTokens += other.CacheReadInputTokens
+}
+
+// Total is the number of tokens read and written, including cached tokens
+func (u Usage) Total() int {
+	return u.InputTokens + u.OutputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+// Delta is an increment of a streamed response. Index identifies the content
+// block it belongs to. A tool_use block is announced with its Name before its
+// input arrives as fragments of JSON in PartialJSON.
+type Delta struct {
+	Index       int    `json:"index"`
+	ContentType string `json:"type"`
+	Text        string `json:"text,omitempty"`
+	Name        string `json:"name,omitempty"`
+	PartialJSON string `json:"partial_json,omitempty"`
 }
 
 type Message struct {
@@ -17,6 +69,10 @@ type Content struct {
 	Input       map[string]interface{} `json:"input,omitempty"`
 	Content     string                 `json:"content,omitempty"`
 	ToolUseId   string                 `json:"tool_use_id,omitempty"`
+	IsError     bool                   `json:"is_error,omitempty"`
+	// RawInput is the input of a tool_use as sent by the model when it is
+	// not a JSON object, Input is then empty. It is not sent to providers.
+	RawInput string `json:"raw_input,omitempty"`
 }
 
 type Tool struct {
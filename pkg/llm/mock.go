@@ -0,0 +1,143 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+var MockFixtureExhaustedErr = errors.New("mock fixture has no more turns")
+
+// Mock replays a scripted sequence of assistant turns for an agent from a
+// fixture file. It is used to exercise workflows without calling a model.
+type Mock struct {
+	agent string
+	model string
+	turns []MockTurn
+}
+
+type MockOptions struct {
+	Agent string
+	// Model is reported as the model of the responses, so that they are
+	// priced like the model's
+	Model   string
+	Fixture string
+}
+
+// MockFixture maps agent names to the assistant turns they return, in order.
+// Fixtures may be written in YAML or JSON and use the same field names as
+// the Anthropic wire format. A turn may report the usage it consumed, e.g.
+//
+//	agents:
+//	  Programmer:
+//	  - content:
+//	    - type: tool_use
+//	      name: Writer
+//	      input:
+//	        filepath: main.py
+//	        content: print("hello")
+//	    usage:
+//	      input_tokens: 1200
+//	      output_tokens: 80
+type MockFixture struct {
+	Agents map[string][]MockTurn `json:"agents"`
+}
+
+type MockTurn struct {
+	Content []Content `json:"content"`
+	Usage   Usage     `json:"usage"`
+}
+
+func NewMock(options *MockOptions) (*Mock, error) {
+	fixture, err := LoadMockFixture(options.Fixture)
+	if err != nil {
+		return nil, err
+	}
+
+	turns := fixture.Agents[options.Agent]
+	for i := range turns {
+		for j := range turns[i].Content {
+			c := &turns[i].Content[j]
+			if c.ContentType == "tool_use" && c.Id == "" {
+				c.Id = fmt.Sprintf("toolu_mock_%s_%d_%d", options.Agent, i, j)
+			}
+			if c.ContentType == "tool_use" && c.Input == nil {
+				c.Input = map[string]interface{}{}
+			}
+		}
+	}
+
+	model := options.Model
+	if model == "" {
+		model = DefaultModels["mock"]
+	}
+
+	return &Mock{
+		agent: options.Agent,
+		model: model,
+		turns: turns,
+	}, nil
+}
+
+func LoadMockFixture(fixturePath string) (*MockFixture, error) {
+	if fixturePath == "" {
+		return nil, fmt.Errorf("a fixture is required for the mock provider")
+	}
+
+	fixtureBytes, err := os.ReadFile(fixturePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode as YAML, which also accepts JSON, and then round trip through
+	// JSON so the fixture shares the field names of Message and Content
+	var raw interface{}
+	err = yaml.Unmarshal(fixtureBytes, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonBytes, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	fixture := MockFixture{}
+	err = json.Unmarshal(jsonBytes, &fixture)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fixture, nil
+}
+
+// Generate returns the turn following the assistant turns already present in
+// messages, so a resumed workflow continues from where its history left off
+func (m *Mock) Generate(ctx context.Context, messages []Message) (*Response, error) {
+	next := 0
+	for _, message := range messages {
+		if message.Role == "assistant" {
+			next++
+		}
+	}
+
+	if next >= len(m.turns) {
+		return nil, fmt.Errorf("%w for agent %s", MockFixtureExhaustedErr, m.agent)
+	}
+
+	turn := m.turns[next]
+	return &Response{
+		Messages: []Message{
+			{
+				Role:    "assistant",
+				Content: turn.Content,
+			},
+		},
+		Usage: turn.Usage,
+		Model: m.model,
+	}, nil
+}
@@ -0,0 +1,54 @@
+package llm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockReplaysTurnsPerAgent(t *testing.T) {
+	fixturePath := filepath.Join(t.TempDir(), "fixture.yaml")
+	err := os.WriteFile(fixturePath, []byte(`
+agents:
+  Programmer:
+  - content:
+    - type: text
+      text: Writing the program
+    - type: tool_use
+      name: Writer
+      input:
+        filepath: main.py
+    usage:
+      input_tokens: 100
+      output_tokens: 20
+  Reviewer:
+  - content:
+    - type: text
+      text: Looks good
+`), 0644)
+	require.NoError(t, err)
+
+	model, err := NewLLMWithName("mock", &ProviderOptions{Agent: "Programmer", Fixture: fixturePath})
+	require.NoError(t, err)
+
+	resp, err := model.Generate(context.Background(), []Message{})
+	require.NoError(t, err)
+	require.Equal(t, "assistant", resp.Messages[0].Role)
+	require.Equal(t, "Writing the program", resp.Messages[0].Content[0].Text)
+	require.Equal(t, "tool_use", resp.Messages[0].Content[1].ContentType)
+	require.Equal(t, "Writer", resp.Messages[0].Content[1].Name)
+	require.Equal(t, "main.py", resp.Messages[0].Content[1].Input["filepath"])
+	require.NotEmpty(t, resp.Messages[0].Content[1].Id)
+	require.Equal(t, Usage{InputTokens: 100, OutputTokens: 20}, resp.Usage)
+
+	_, err = model.Generate(context.Background(), resp.Messages)
+	require.ErrorIs(t, err, MockFixtureExhaustedErr)
+}
+
+func TestMockRequiresFixture(t *testing.T) {
+	_, err := NewLLMWithName("mock", &ProviderOptions{Agent: "Programmer"})
+	require.Error(t, err)
+}
@@ -0,0 +1,325 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// OpenAI speaks the OpenAI chat completions wire format which is also served
+// by compatible local servers such as vLLM, llama.cpp server and LM Studio
+type OpenAI struct {
+	apiKey  string
+	baseURL string
+	model   string
+	tools   []Tool
+
+	temperature   *float32
+	topP          *float32
+	topK          *int
+	maxTokens     int
+	stopSequences []string
+
+	client  *http.Client
+	retry   RetryOptions
+	limiter *Limiter
+}
+
+type OpenAIOptions struct {
+	APIKey  string
+	BaseURL string
+	Model   string
+	Tools   []Tool
+
+	Temperature   *float32
+	TopP          *float32
+	TopK          *int
+	MaxTokens     int
+	StopSequences []string
+
+	// Timeout bounds a single request, zero uses DefaultTimeout
+	Timeout    time.Duration
+	MaxRetries int
+	// Limiter is shared with other models using the same provider
+	Limiter *Limiter
+}
+
+func NewOpenAI(options *OpenAIOptions) *OpenAI {
+
+	if options.APIKey == "" {
+		options.APIKey = os.Getenv("OPENAI_API_KEY")
+	}
+
+	if options.BaseURL == "" {
+		options.BaseURL = "https://api.openai.com/v1"
+	}
+
+	if options.Model == "" {
+		options.Model = DefaultModels["openai"]
+	}
+
+	if options.Tools == nil {
+		options.Tools = []Tool{}
+	}
+
+	if options.Timeout == 0 {
+		options.Timeout = DefaultTimeout
+	}
+
+	return &OpenAI{
+		apiKey:  options.APIKey,
+		baseURL: strings.TrimSuffix(options.BaseURL, "/"),
+		model:   options.Model,
+		tools:   options.Tools,
+
+		temperature:   options.Temperature,
+		topP:          options.TopP,
+		topK:          options.TopK,
+		maxTokens:     options.MaxTokens,
+		stopSequences: options.StopSequences,
+
+		client:  &http.Client{Timeout: options.Timeout},
+		retry:   RetryOptions{MaxRetries: options.MaxRetries},
+		limiter: options.Limiter,
+	}
+}
+
+func (o *OpenAI) Generate(ctx context.Context, messages []Message) (*Response, error) {
+	rb := openAIReqBody{
+		Model:       o.model,
+		Messages:    toOpenAIMessages(messages),
+		Temperature: o.temperature,
+		TopP:        o.topP,
+		TopK:        o.topK,
+		MaxTokens:   o.maxTokens,
+		Stop:        o.stopSequences,
+	}
+
+	for _, t := range o.tools {
+		rb.Tools = append(rb.Tools, openAITool{
+			Type: "function",
+			Function: openAIFunction{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Schema,
+			},
+		})
+	}
+
+	rbBytes, err := json.Marshal(rb)
+	if err != nil {
+		return nil, err
+	}
+
+	respBytes, err := doWithRetry(ctx, "OpenAI", o.client, o.limiter, o.retry, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/chat/completions", o.baseURL), bytes.NewBuffer(rbBytes))
+		if err != nil {
+			return nil, err
+		}
+
+		if o.apiKey != "" {
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", o.apiKey))
+		}
+		req.Header.Add("content-type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	or := openAIResponse{}
+	err = json.Unmarshal(respBytes, &or)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(or.Choices) == 0 {
+		return nil, fmt.Errorf("Error calling OpenAI: no choices returned")
+	}
+
+	content := fromOpenAIMessage(or.Choices[0].Message)
+
+	model := or.Model
+	if model == "" {
+		model = o.model
+	}
+
+	// prompt_tokens includes cached tokens which are reported separately
+	cached := or.Usage.PromptTokensDetails.CachedTokens
+	return &Response{
+		Messages: []Message{
+			{
+				Role:    "assistant",
+				Content: content,
+			},
+		},
+		Usage: Usage{
+			InputTokens:          or.Usage.PromptTokens - cached,
+			OutputTokens:         or.Usage.CompletionTokens,
+			CacheReadInputTokens: cached,
+		},
+		Model: model,
+	}, nil
+}
+
+// toOpenAIMessages flattens content blocks into chat messages. Each
+// tool_result becomes its own message with the "tool" role.
+func toOpenAIMessages(messages []Message) []openAIMessage {
+	var result []openAIMessage
+	for _, m := range messages {
+		var texts []string
+		var toolCalls []openAIToolCall
+		for _, c := range m.Content {
+			switch c.ContentType {
+			case "tool_use":
+				args, err := json.Marshal(c.Input)
+				if err != nil || c.Input == nil {
+					args = []byte("{}")
+				}
+				// The model is shown the arguments it sent
+				if c.RawInput != "" {
+					args = []byte(c.RawInput)
+				}
+				toolCalls = append(toolCalls, openAIToolCall{
+					Id:   c.Id,
+					Type: "function",
+					Function: openAIFunctionCall{
+						Name:      c.Name,
+						Arguments: string(args),
+					},
+				})
+			case "tool_result":
+				result = append(result, openAIMessage{
+					Role:       "tool",
+					Content:    contentText(c),
+					ToolCallId: c.ToolUseId,
+				})
+			default:
+				texts = append(texts, contentText(c))
+			}
+		}
+
+		if len(texts) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+
+		result = append(result, openAIMessage{
+			Role:      m.Role,
+			Content:   strings.Join(texts, "\n"),
+			ToolCalls: toolCalls,
+		})
+	}
+
+	return result
+}
+
+func fromOpenAIMessage(m openAIMessage) []Content {
+	var content []Content
+	if m.Content != "" {
+		content = append(content, Content{
+			ContentType: "text",
+			Text:        m.Content,
+		})
+	}
+
+	for _, tc := range m.ToolCalls {
+		input, rawInput := parseToolInput(tc.Function.Arguments)
+		content = append(content, Content{
+			ContentType: "tool_use",
+			Id:          tc.Id,
+			Name:        tc.Function.Name,
+			Input:       input,
+			RawInput:    rawInput,
+		})
+	}
+
+	return content
+}
+
+// parseToolInput decodes the JSON object of a tool call. Input that is not
+// a JSON object is returned as rawInput so that the call can be answered
+// with an error, models and compatible servers sometimes send broken JSON.
+func parseToolInput(arguments string) (input map[string]interface{}, rawInput string) {
+	input = map[string]interface{}{}
+	if strings.TrimSpace(arguments) == "" {
+		return input, ""
+	}
+
+	err := json.Unmarshal([]byte(arguments), &input)
+	if err != nil || input == nil {
+		return map[string]interface{}{}, arguments
+	}
+	return input, ""
+}
+
+// contentText returns the text of a content block. Some callers populate
+// Content rather than Text for plain text blocks.
+func contentText(c Content) string {
+	if c.Text != "" {
+		return c.Text
+	}
+	return c.Content
+}
+
+type openAIReqBody struct {
+	Model       string          `json:"model"`
+	Messages    []openAIMessage `json:"messages"`
+	Tools       []openAITool    `json:"tools,omitempty"`
+	Temperature *float32        `json:"temperature,omitempty"`
+	TopP        *float32        `json:"top_p,omitempty"`
+	// TopK is not part of the OpenAI API but is accepted by compatible
+	// servers such as vLLM and llama.cpp server
+	TopK      *int     `json:"top_k,omitempty"`
+	MaxTokens int      `json:"max_tokens,omitempty"`
+	Stop      []string `json:"stop,omitempty"`
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallId string           `json:"tool_call_id,omitempty"`
+}
+
+type openAITool struct {
+	Type     string         `json:"type"`
+	Function openAIFunction `json:"function"`
+}
+
+type openAIFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+type openAIToolCall struct {
+	Id       string             `json:"id"`
+	Type     string             `json:"type"`
+	Function openAIFunctionCall `json:"function"`
+}
+
+type openAIFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type openAIResponse struct {
+	Id      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens        int `json:"prompt_tokens"`
+		CompletionTokens    int `json:"completion_tokens"`
+		PromptTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"prompt_tokens_details"`
+	} `json:"usage"`
+}
@@ -0,0 +1,207 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIGenerateToolCall(t *testing.T) {
+	var received openAIReqBody
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/chat/completions", r.URL.Path)
+		require.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &received))
+
+		w.Write([]byte(`{
+			"id": "chatcmpl-1",
+			"model": "local-model",
+			"choices": [{
+				"finish_reason": "tool_calls",
+				"message": {
+					"role": "assistant",
+					"content": null,
+					"tool_calls": [{
+						"id": "call_2",
+						"type": "function",
+						"function": {"name": "Writer", "arguments": "{\"filepath\": \"main.py\", \"content\": \"print(1)\"}"}
+					}]
+				}
+			}]
+		}`))
+	}))
+	defer server.Close()
+
+	model := NewOpenAI(&OpenAIOptions{
+		APIKey:  "test-key",
+		BaseURL: server.URL + "/v1/",
+		Model:   "local-model",
+		Tools: []Tool{
+			{Name: "Writer", Description: "Write files", Schema: map[string]interface{}{"type": "object"}},
+		},
+	})
+
+	resp, err := model.Generate(context.Background(), []Message{
+		{Role: "system", Content: []Content{{ContentType: "text", Text: "You are a programmer"}}},
+		{Role: "user", Content: []Content{{ContentType: "text", Text: "Write a program"}}},
+		{Role: "assistant", Content: []Content{
+			{ContentType: "text", Text: "Reading the file first"},
+			{ContentType: "tool_use", Id: "call_1", Name: "Reader", Input: map[string]interface{}{"filepath": "main.py"}},
+		}},
+		{Role: "user", Content: []Content{{ContentType: "tool_result", ToolUseId: "call_1", Content: "print(0)"}}},
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, "local-model", received.Model)
+	require.Equal(t, "function", received.Tools[0].Type)
+	require.Equal(t, "Writer", received.Tools[0].Function.Name)
+	require.Equal(t, 4, len(received.Messages))
+	require.Equal(t, "system", received.Messages[0].Role)
+	require.Equal(t, "Reading the file first", received.Messages[2].Content)
+	require.Equal(t, "Reader", received.Messages[2].ToolCalls[0].Function.Name)
+	require.JSONEq(t, `{"filepath": "main.py"}`, received.Messages[2].ToolCalls[0].Function.Arguments)
+	require.Equal(t, "tool", received.Messages[3].Role)
+	require.Equal(t, "call_1", received.Messages[3].ToolCallId)
+	require.Equal(t, "print(0)", received.Messages[3].Content)
+
+	require.Equal(t, 1, len(resp.Messages))
+	require.Equal(t, "assistant", resp.Messages[0].Role)
+	require.Equal(t, "tool_use", resp.Messages[0].Content[0].ContentType)
+	require.Equal(t, "call_2", resp.Messages[0].Content[0].Id)
+	require.Equal(t, "Writer", resp.Messages[0].Content[0].Name)
+	require.Equal(t, "main.py", resp.Messages[0].Content[0].Input["filepath"])
+}
+
+func TestOpenAIGenerateToolCallWithInvalidArguments(t *testing.T) {
+	var received openAIReqBody
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &received))
+
+		w.Write([]byte(`{
+			"choices": [{
+				"message": {
+					"role": "assistant",
+					"tool_calls": [{
+						"id": "call_2",
+						"type": "function",
+						"function": {"name": "Writer", "arguments": "{\"filepath\": main.py"}
+					}]
+				}
+			}]
+		}`))
+	}))
+	defer server.Close()
+
+	model := NewOpenAI(&OpenAIOptions{BaseURL: server.URL})
+	resp, err := model.Generate(context.Background(), []Message{
+		{Role: "assistant", Content: []Content{{ContentType: "tool_use", Id: "call_1", Name: "Reader", Input: map[string]interface{}{}, RawInput: "[1]"}}},
+	})
+	require.NoError(t, err)
+
+	// The arguments are kept for the tool call to be answered with an error
+	call := resp.Messages[0].Content[0]
+	require.Equal(t, "call_2", call.Id)
+	require.Equal(t, map[string]interface{}{}, call.Input)
+	require.Equal(t, `{"filepath": main.py`, call.RawInput)
+
+	// and the model is shown what it sent
+	require.Equal(t, "[1]", received.Messages[0].ToolCalls[0].Function.Arguments)
+}
+
+func TestParseToolInput(t *testing.T) {
+	for arguments, expected := range map[string]map[string]interface{}{
+		"":              {},
+		`{"a": 1}`:      {"a": float64(1)},
+		"null":          nil,
+		"[1]":           nil,
+		`{"a": "b"`:     nil,
+		"  ":            {},
+		`"a string"`:    nil,
+		`{"a": [true]}`: {"a": []interface{}{true}},
+	} {
+		input, rawInput := parseToolInput(arguments)
+		if expected == nil {
+			require.Equal(t, map[string]interface{}{}, input, arguments)
+			require.Equal(t, arguments, rawInput)
+			continue
+		}
+		require.Equal(t, expected, input, arguments)
+		require.Equal(t, "", rawInput)
+	}
+}
+
+func TestOpenAIGenerateText(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Empty(t, r.Header.Get("Authorization"))
+		w.Write([]byte(`{
+			"choices": [{"message": {"role": "assistant", "content": "Hello"}}],
+			"usage": {"prompt_tokens": 120, "completion_tokens": 8, "prompt_tokens_details": {"cached_tokens": 100}}
+		}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("OPENAI_API_KEY", "")
+	model := NewOpenAI(&OpenAIOptions{BaseURL: server.URL})
+	resp, err := model.Generate(context.Background(), []Message{
+		{Role: "user", Content: []Content{{ContentType: "text", Text: "Hi"}}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "text", resp.Messages[0].Content[0].ContentType)
+	require.Equal(t, "Hello", resp.Messages[0].Content[0].Text)
+	require.Equal(t, Usage{InputTokens: 20, OutputTokens: 8, CacheReadInputTokens: 100}, resp.Usage)
+}
+
+func TestOpenAIGenerateError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": {"message": "bad request"}}`))
+	}))
+	defer server.Close()
+
+	model := NewOpenAI(&OpenAIOptions{BaseURL: server.URL})
+	_, err := model.Generate(context.Background(), []Message{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "bad request")
+}
+
+func TestOpenAIGenerateSendsSamplingParameters(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &received))
+
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "Hello"}}]}`))
+	}))
+	defer server.Close()
+
+	temperature := float32(0.2)
+	topK := 20
+	model := NewOpenAI(&OpenAIOptions{
+		BaseURL:       server.URL,
+		Temperature:   &temperature,
+		TopK:          &topK,
+		MaxTokens:     256,
+		StopSequences: []string{"STOP"},
+	})
+	_, err := model.Generate(context.Background(), []Message{
+		{Role: "user", Content: []Content{{ContentType: "text", Text: "Hi"}}},
+	})
+	require.NoError(t, err)
+
+	require.InDelta(t, 0.2, received["temperature"], 0.0001)
+	require.Equal(t, float64(20), received["top_k"])
+	require.Equal(t, float64(256), received["max_tokens"])
+	require.Equal(t, []interface{}{"STOP"}, received["stop"])
+	require.NotContains(t, received, "top_p")
+}
@@ -0,0 +1,54 @@
+package llm
+
+import "regexp"
+
+// ModelPrice is the price of a model in US dollars per million tokens
+type ModelPrice struct {
+	Input      float64 `yaml:"input"`
+	Output     float64 `yaml:"output"`
+	CacheWrite float64 `yaml:"cache_write"`
+	CacheRead  float64 `yaml:"cache_read"`
+}
+
+// DefaultPrices lists published prices for commonly used models. Workflows
+// can add or override entries using the pricing section of the manifest.
+var DefaultPrices = map[string]ModelPrice{
+	"claude-3-5-sonnet-20240620": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	"claude-3-5-sonnet-20241022": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	"claude-3-5-haiku-20241022":  {Input: 0.80, Output: 4, CacheWrite: 1, CacheRead: 0.08},
+	"claude-3-opus-20240229":     {Input: 15, Output: 75, CacheWrite: 18.75, CacheRead: 1.50},
+	"claude-3-sonnet-20240229":   {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	"claude-3-haiku-20240307":    {Input: 0.25, Output: 1.25, CacheWrite: 0.30, CacheRead: 0.03},
+	"gpt-4o":                     {Input: 2.50, Output: 10, CacheRead: 1.25},
+	"gpt-4o-mini":                {Input: 0.15, Output: 0.60, CacheRead: 0.075},
+	// The mock provider is free unless its agents set a model
+	"mock": {},
+}
+
+// Cost returns the price in US dollars of the tokens in usage
+func (p ModelPrice) Cost(u Usage) float64 {
+	return (float64(u.InputTokens)*p.Input +
+		float64(u.OutputTokens)*p.Output +
+		float64(u.CacheCreationInputTokens)*p.CacheWrite +
+		float64(u.CacheReadInputTokens)*p.CacheRead) / 1_000_000
+}
+
+// datedSnapshot matches the date that providers such as OpenAI append to
+// the model they report, for example gpt-4o-mini-2024-07-18
+var datedSnapshot = regexp.MustCompile(`-\d{4}-\d{2}-\d{2}$`)
+
+// PriceFor looks the model up in overrides before DefaultPrices, then does
+// the same without a trailing -YYYY-MM-DD date. The second return value is
+// false when the model has no known price.
+func PriceFor(model string, overrides map[string]ModelPrice) (ModelPrice, bool) {
+	for _, name := range []string{model, datedSnapshot.ReplaceAllString(model, "")} {
+		if price, exists := overrides[name]; exists {
+			return price, true
+		}
+		if price, exists := DefaultPrices[name]; exists {
+			return price, true
+		}
+	}
+
+	return ModelPrice{}, false
+}
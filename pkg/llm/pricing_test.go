@@ -0,0 +1,43 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelPriceCost(t *testing.T) {
+	price, found := PriceFor("claude-3-5-sonnet-20240620", nil)
+	require.True(t, found)
+
+	cost := price.Cost(Usage{
+		InputTokens:              1_000_000,
+		OutputTokens:             100_000,
+		CacheCreationInputTokens: 200_000,
+		CacheReadInputTokens:     1_000_000,
+	})
+	require.InDelta(t, 3+1.5+0.75+0.30, cost, 0.000001)
+}
+
+func TestPriceForOverrides(t *testing.T) {
+	overrides := map[string]ModelPrice{
+		"claude-3-haiku-20240307": {Input: 1, Output: 2},
+		"local-model":             {},
+	}
+
+	price, found := PriceFor("claude-3-haiku-20240307", overrides)
+	require.True(t, found)
+	require.Equal(t, float64(1), price.Input)
+
+	_, found = PriceFor("local-model", overrides)
+	require.True(t, found)
+
+	_, found = PriceFor("unknown-model", overrides)
+	require.False(t, found)
+}
+
+func TestPriceForDatedSnapshots(t *testing.T) {
+	price, found := PriceFor("gpt-4o-mini-2024-07-18", nil)
+	require.True(t, found)
+	require.Equal(t, DefaultPrices["gpt-4o-mini"], price)
+}
@@ -0,0 +1,128 @@
+package llm
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultProvider is used for agents that do not specify a provider
+const DefaultProvider = "anthropic"
+
+// DefaultModels are the models used by providers when none is set
+var DefaultModels = map[string]string{
+	"anthropic": "claude-3-haiku-20240307",
+	"openai":    "gpt-4o-mini",
+	"mock":      "mock",
+}
+
+type ProviderOptions struct {
+	APIKey  string
+	BaseURL string
+	Model   string
+	Tools   []Tool
+
+	// Sampling parameters, nil or zero values use the provider's defaults
+	Temperature   *float32
+	TopP          *float32
+	TopK          *int
+	MaxTokens     int
+	StopSequences []string
+
+	Timeout    time.Duration
+	MaxRetries int
+	Limiter    *Limiter
+
+	// Agent is the name of the agent the model is created for
+	Agent string
+	// Fixture is the path to the scripted turns used by the mock provider
+	Fixture string
+}
+
+type ProviderFactory func(options *ProviderOptions) (LLM, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]ProviderFactory{
+		"anthropic": func(options *ProviderOptions) (LLM, error) {
+			return NewAnthropic(&AnthropicOptions{
+				APIKey:  options.APIKey,
+				BaseURL: options.BaseURL,
+				Model:   options.Model,
+				Tools:   options.Tools,
+
+				Temperature:   options.Temperature,
+				TopP:          options.TopP,
+				TopK:          options.TopK,
+				MaxTokens:     options.MaxTokens,
+				StopSequences: options.StopSequences,
+
+				Timeout:    options.Timeout,
+				MaxRetries: options.MaxRetries,
+				Limiter:    options.Limiter,
+			}), nil
+		},
+		"openai": func(options *ProviderOptions) (LLM, error) {
+			return NewOpenAI(&OpenAIOptions{
+				APIKey:  options.APIKey,
+				BaseURL: options.BaseURL,
+				Model:   options.Model,
+				Tools:   options.Tools,
+
+				Temperature:   options.Temperature,
+				TopP:          options.TopP,
+				TopK:          options.TopK,
+				MaxTokens:     options.MaxTokens,
+				StopSequences: options.StopSequences,
+
+				Timeout:    options.Timeout,
+				MaxRetries: options.MaxRetries,
+				Limiter:    options.Limiter,
+			}), nil
+		},
+		"mock": func(options *ProviderOptions) (LLM, error) {
+			return NewMock(&MockOptions{
+				Agent:   options.Agent,
+				Model:   options.Model,
+				Fixture: options.Fixture,
+			})
+		},
+	}
+)
+
+// RegisterProvider makes a provider available to workflows under name.
+// Registering a name that already exists replaces the previous factory.
+func RegisterProvider(name string, factory ProviderFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[name] = factory
+}
+
+func NewLLMWithName(name string, options *ProviderOptions) (LLM, error) {
+	if name == "" {
+		name = DefaultProvider
+	}
+
+	providersMu.RLock()
+	factory, exists := providers[name]
+	providersMu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("invalid provider %s", name)
+	}
+
+	return factory(options)
+}
+
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	names := []string{}
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,53 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type echoLLM struct {
+	model string
+}
+
+func (e *echoLLM) Generate(ctx context.Context, messages []Message) (*Response, error) {
+	return &Response{
+		Messages: []Message{
+			{
+				Role:    "assistant",
+				Content: []Content{{ContentType: "text", Text: e.model}},
+			},
+		},
+		Usage: Usage{InputTokens: 10, OutputTokens: 2},
+	}, nil
+}
+
+func TestRegisterProvider(t *testing.T) {
+	RegisterProvider("echo", func(options *ProviderOptions) (LLM, error) {
+		return &echoLLM{model: options.Model}, nil
+	})
+
+	model, err := NewLLMWithName("echo", &ProviderOptions{Model: "echo-1"})
+	require.NoError(t, err)
+	require.Contains(t, Providers(), "echo")
+
+	resp, err := model.Generate(context.Background(), []Message{})
+	require.NoError(t, err)
+	require.Equal(t, "echo-1", resp.Messages[0].Content[0].Text)
+}
+
+func TestNewLLMWithNameDefaultsToAnthropic(t *testing.T) {
+	model, err := NewLLMWithName("", &ProviderOptions{})
+	require.NoError(t, err)
+
+	anthropic, ok := model.(*Anthropic)
+	require.True(t, ok)
+	require.Equal(t, "claude-3-haiku-20240307", anthropic.model)
+}
+
+func TestNewLLMWithNameInvalidProvider(t *testing.T) {
+	_, err := NewLLMWithName("unknown", &ProviderOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid provider unknown")
+}
@@ -0,0 +1,163 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxRetries     = 3
+	DefaultTimeout        = 5 * time.Minute
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = time.Minute
+)
+
+// sleep is replaced in tests to avoid waiting on backoffs
+var sleep = sleepContext
+
+// sleepContext waits for d or until ctx is cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type RetryOptions struct {
+	// MaxRetries is the number of times a failed request is retried. Zero
+	// uses DefaultMaxRetries and a negative value disables retries.
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+func (ro RetryOptions) withDefaults() RetryOptions {
+	if ro.MaxRetries == 0 {
+		ro.MaxRetries = DefaultMaxRetries
+	}
+	if ro.MaxRetries < 0 {
+		ro.MaxRetries = 0
+	}
+	if ro.InitialBackoff == 0 {
+		ro.InitialBackoff = DefaultInitialBackoff
+	}
+	if ro.MaxBackoff == 0 {
+		ro.MaxBackoff = DefaultMaxBackoff
+	}
+	return ro
+}
+
+// backoff returns an exponential delay with full jitter for the given
+// attempt, or the delay requested by the provider if it is longer
+func (ro RetryOptions) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	ceiling := ro.InitialBackoff << attempt
+	if ceiling <= 0 || ceiling > ro.MaxBackoff {
+		ceiling = ro.MaxBackoff
+	}
+
+	delay := time.Duration(rand.Int63n(int64(ceiling)) + 1)
+	if retryAfter > delay {
+		return retryAfter
+	}
+
+	return delay
+}
+
+// doWithRetry sends the request built by newRequest, retrying rate limits,
+// overloads, server errors and transport failures. The response body is
+// returned for successful requests and an *APIError for error statuses.
+func doWithRetry(ctx context.Context, provider string, client *http.Client, limiter *Limiter, retry RetryOptions, newRequest func() (*http.Request, error)) ([]byte, error) {
+	resp, err := openWithRetry(ctx, provider, client, limiter, retry, new(int), newRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
+
+// openWithRetry is like doWithRetry but returns the successful response
+// unread so that it can be streamed. The limiter slot is held until the
+// response body is closed. attempt is the number of attempts already made,
+// it is advanced by the retries so that callers retrying failures of the
+// response share the retry budget.
+func openWithRetry(ctx context.Context, provider string, client *http.Client, limiter *Limiter, retry RetryOptions, attempt *int, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	retry = retry.withDefaults()
+
+	for ; ; *attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		release, err := limiter.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := send(provider, client, req)
+		if err == nil {
+			resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+			return resp, nil
+		}
+		release()
+
+		// Cancellation is not retried
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		var apiErr *APIError
+		isAPIErr := errors.As(err, &apiErr)
+		if *attempt >= retry.MaxRetries || (isAPIErr && !apiErr.Retryable()) {
+			return nil, err
+		}
+
+		var retryAfter time.Duration
+		if isAPIErr {
+			retryAfter = apiErr.RetryAfter
+		}
+		err = sleep(ctx, retry.backoff(*attempt, retryAfter))
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func send(provider string, client *http.Client, req *http.Request) (*http.Response, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		respBytes, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return nil, newAPIError(provider, resp, respBytes)
+	}
+
+	return resp, nil
+}
+
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (rb *releasingBody) Close() error {
+	rb.once.Do(rb.release)
+	return rb.ReadCloser.Close()
+}
@@ -0,0 +1,197 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func stubSleep(t *testing.T) *[]time.Duration {
+	delays := []time.Duration{}
+	original := sleep
+	sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	t.Cleanup(func() {
+		sleep = original
+	})
+
+	return &delays
+}
+
+func TestAnthropicRetriesOverloaded(t *testing.T) {
+	delays := stubSleep(t)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(529)
+			w.Write([]byte(`{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`))
+			return
+		}
+		w.Write([]byte(`{"id": "msg_1", "content": [{"type": "text", "text": "Hello"}]}`))
+	}))
+	defer server.Close()
+
+	model := NewAnthropic(&AnthropicOptions{BaseURL: server.URL})
+	resp, err := model.Generate(context.Background(), []Message{{Role: "user", Content: []Content{{ContentType: "text", Text: "Hi"}}}})
+	require.NoError(t, err)
+	require.Equal(t, "Hello", resp.Messages[0].Content[0].Text)
+	require.Equal(t, 3, calls)
+	require.Equal(t, 2, len(*delays))
+	require.LessOrEqual(t, (*delays)[0], DefaultInitialBackoff)
+	require.LessOrEqual(t, (*delays)[1], 2*DefaultInitialBackoff)
+}
+
+func TestAnthropicHonorsRetryAfter(t *testing.T) {
+	delays := stubSleep(t)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("retry-after", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"type": "error", "error": {"type": "rate_limit_error", "message": "Slow down"}}`))
+			return
+		}
+		w.Write([]byte(`{"id": "msg_1", "content": [{"type": "text", "text": "Hello"}]}`))
+	}))
+	defer server.Close()
+
+	model := NewAnthropic(&AnthropicOptions{BaseURL: server.URL})
+	_, err := model.Generate(context.Background(), []Message{{Role: "user", Content: []Content{{ContentType: "text", Text: "Hi"}}}})
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{7 * time.Second}, *delays)
+}
+
+func TestAnthropicDoesNotRetryAuthenticationErrors(t *testing.T) {
+	stubSleep(t)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"type": "error", "error": {"type": "authentication_error", "message": "invalid x-api-key"}}`))
+	}))
+	defer server.Close()
+
+	model := NewAnthropic(&AnthropicOptions{BaseURL: server.URL})
+	_, err := model.Generate(context.Background(), []Message{{Role: "user", Content: []Content{{ContentType: "text", Text: "Hi"}}}})
+	require.ErrorIs(t, err, AuthenticationErr)
+	require.Contains(t, err.Error(), "invalid x-api-key")
+	require.Equal(t, 1, calls)
+
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, "authentication_error", apiErr.Type)
+	require.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+}
+
+func TestAnthropicGivesUpAfterMaxRetries(t *testing.T) {
+	stubSleep(t)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	model := NewAnthropic(&AnthropicOptions{BaseURL: server.URL, MaxRetries: 2})
+	_, err := model.Generate(context.Background(), []Message{{Role: "user", Content: []Content{{ContentType: "text", Text: "Hi"}}}})
+	require.ErrorIs(t, err, RateLimitedErr)
+	require.Equal(t, 3, calls)
+}
+
+func TestOpenAIRequestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	model := NewOpenAI(&OpenAIOptions{BaseURL: server.URL, Timeout: 20 * time.Millisecond, MaxRetries: -1})
+	_, err := model.Generate(context.Background(), []Message{{Role: "user", Content: []Content{{ContentType: "text", Text: "Hi"}}}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Timeout")
+}
+
+func TestLimiterBoundsConcurrency(t *testing.T) {
+	limiter := NewLimiter(2, 0)
+
+	var inFlight, maxInFlight int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := limiter.Acquire(context.Background())
+			require.NoError(t, err)
+			defer release()
+
+			current := atomic.AddInt32(&inFlight, 1)
+			for {
+				seen := atomic.LoadInt32(&maxInFlight)
+				if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+		}()
+	}
+	wg.Wait()
+
+	require.LessOrEqual(t, maxInFlight, int32(2))
+}
+
+func TestLimiterTokenBucket(t *testing.T) {
+	limiter := NewLimiter(0, 2)
+
+	require.Equal(t, time.Duration(0), limiter.take())
+	require.Equal(t, time.Duration(0), limiter.take())
+
+	// The bucket refills at two requests per minute
+	wait := limiter.take()
+	require.Greater(t, wait, 25*time.Second)
+	require.LessOrEqual(t, wait, 30*time.Second)
+}
+
+func TestAnthropicStopsRetryingWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		cancel()
+		w.WriteHeader(529)
+		w.Write([]byte(`{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`))
+	}))
+	defer server.Close()
+
+	model := NewAnthropic(&AnthropicOptions{BaseURL: server.URL})
+	_, err := model.Generate(ctx, []Message{{Role: "user", Content: []Content{{ContentType: "text", Text: "Hi"}}}})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 1, calls)
+}
+
+func TestLimiterAcquireCancelled(t *testing.T) {
+	limiter := NewLimiter(1, 0)
+	release, err := limiter.Acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = limiter.Acquire(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -2,6 +2,8 @@ package planning
 
 import (
 	"clan/pkg/llm"
+	"context"
+	"fmt"
 )
 
 type CreatePlan struct {
@@ -49,16 +51,30 @@ func (cp *CreatePlan) Schema() llm.Tool {
 	}
 }
 
-func (cp *CreatePlan) Execute(input map[string]interface{}) (string, error) {
+func (cp *CreatePlan) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
 	cp.CurrentPlan = []Task{}
 
-	for _, t := range input["tasks"].([]interface{}) {
-		tt := t.(map[string]interface{})
-		task := Task{
-			Name:        tt["name"].(string),
-			Description: tt["description"].(string),
-			Owner:       tt["owner"].(string),
-			Status:      "Not Started",
+	tasks, ok := input["tasks"].([]interface{})
+	if !ok {
+		return "", fmt.Errorf("parameter tasks must be a list of tasks")
+	}
+
+	for i, t := range tasks {
+		tt, ok := t.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("tasks[%d] must be an object", i)
+		}
+
+		task := Task{Status: "Not Started"}
+		fields := []struct {
+			name  string
+			value *string
+		}{{"name", &task.Name}, {"description", &task.Description}, {"owner", &task.Owner}}
+		for _, field := range fields {
+			*field.value, ok = tt[field.name].(string)
+			if !ok {
+				return "", fmt.Errorf("tasks[%d].%s must be a string", i, field.name)
+			}
 		}
 		cp.CurrentPlan = append(cp.CurrentPlan, task)
 	}
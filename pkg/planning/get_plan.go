@@ -1,6 +1,9 @@
 package planning
 
-import "clan/pkg/llm"
+import (
+	"clan/pkg/llm"
+	"context"
+)
 
 type GetPlan struct {
 }
@@ -29,7 +32,7 @@ func (plan *GetPlan) Schema() llm.Tool {
 	}
 }
 
-func (plan *GetPlan) Execute(map[string]interface{}) (string, error) {
+func (plan *GetPlan) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
 	return "", nil
 }
 
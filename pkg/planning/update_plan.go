@@ -1,6 +1,9 @@
 package planning
 
-import "clan/pkg/llm"
+import (
+	"clan/pkg/llm"
+	"context"
+)
 
 type UpdatePlan struct {
 	CurrentPlan []Task
@@ -34,7 +37,7 @@ func (cp *UpdatePlan) Schema() llm.Tool {
 	}
 }
 
-func (cp *UpdatePlan) Execute(input map[string]interface{}) (string, error) {
+func (cp *UpdatePlan) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
 	return "Tasks updated", nil
 }
 
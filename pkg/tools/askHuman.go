@@ -0,0 +1,40 @@
+package tools
+
+import (
+	"clan/pkg/llm"
+	"context"
+	"errors"
+)
+
+type askHuman struct{}
+
+// NewAskHuman returns the tool agents call to ask a person a question. Its
+// calls are answered by the workflow, which can reach the person.
+func NewAskHuman() Tool {
+	return &askHuman{}
+}
+
+func (ah *askHuman) Name() string {
+	return "AskHuman"
+}
+
+func (ah *askHuman) Schema() llm.Tool {
+	return llm.Tool{
+		Name:        ah.Name(),
+		Description: "Ask the person running the workflow a question and wait for the answer. Use it when you need a decision or information that only a person can give.",
+		Schema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"question": map[string]interface{}{
+					"type":        "string",
+					"description": "Question to ask, with the context needed to answer it",
+				},
+			},
+			"required": []string{"question"},
+		},
+	}
+}
+
+func (ah *askHuman) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	return "", errors.New("AskHuman can only be answered within a workflow")
+}
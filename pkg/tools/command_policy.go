@@ -0,0 +1,173 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	CommandDeniedErr   = errors.New("command denied")
+	CommandRejectedErr = errors.New("command rejected")
+)
+
+const (
+	// ApproveAlways asks for approval before running any command that is not
+	// denied
+	ApproveAlways = "always"
+	// ApproveUnlisted asks for approval before running commands that are not
+	// allowed by Allow or AllowPatterns, instead of denying them
+	ApproveUnlisted = "unlisted"
+)
+
+// Approval is the answer of a person asked whether a command may run
+type Approval struct {
+	Approved bool
+	// Command replaces the requested command when it is not empty
+	Command string
+	Reason  string
+}
+
+// Approver asks a person whether command may run
+type Approver func(ctx context.Context, command string) (Approval, error)
+
+type policyDecision int
+
+const (
+	policyAllow policyDecision = iota
+	policyDeny
+	policyAsk
+)
+
+// check applies the policy of o to cmd. Denied patterns are checked first,
+// then the allowlist, which allows everything when it is empty.
+func (o CommandOptions) check(cmd string) (policyDecision, string) {
+	for _, pattern := range o.DenyPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return policyDeny, fmt.Sprintf("invalid deny pattern %s: %s", pattern, err)
+		}
+		if re.MatchString(cmd) {
+			return policyDeny, fmt.Sprintf("it matches the denied pattern %s", pattern)
+		}
+	}
+
+	listed := len(o.Allow) == 0 && len(o.AllowPatterns) == 0
+	if !listed {
+		listed = o.allowed(cmd)
+	}
+
+	switch {
+	case o.Approve == ApproveAlways:
+		return policyAsk, ""
+	case listed:
+		return policyAllow, ""
+	case o.Approve == ApproveUnlisted:
+		return policyAsk, ""
+	default:
+		return policyDeny, "it is not in the allowlist"
+	}
+}
+
+// allowed is true when cmd matches one of AllowPatterns entirely or when
+// every program it runs is in Allow
+func (o CommandOptions) allowed(cmd string) bool {
+	for _, pattern := range o.AllowPatterns {
+		re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+		if err == nil && re.MatchString(cmd) {
+			return true
+		}
+	}
+
+	if len(o.Allow) == 0 {
+		return false
+	}
+
+	programs := []string{}
+	if o.Shell {
+		var ok bool
+		programs, ok = shellPrograms(cmd)
+		if !ok {
+			return false
+		}
+	} else {
+		args, err := splitCommand(cmd)
+		if err != nil {
+			return false
+		}
+		programs = append(programs, args[0])
+	}
+
+	for _, program := range programs {
+		if !slices.Contains(o.Allow, program) {
+			return false
+		}
+	}
+	return len(programs) > 0
+}
+
+// shellPrograms returns the program run by every command of a shell command
+// line, split on unquoted |, &, ; and newlines. ok is false when the line
+// runs commands that cannot be told apart, such as command substitutions and
+// subshells.
+func shellPrograms(cmd string) (programs []string, ok bool) {
+	if strings.Contains(cmd, "`") || strings.Contains(cmd, "$(") || strings.Contains(cmd, "<(") || strings.Contains(cmd, ">(") {
+		return nil, false
+	}
+
+	segment := strings.Builder{}
+	addSegment := func() bool {
+		text := segment.String()
+		segment.Reset()
+		// Empty segments, such as the one after a trailing &, run nothing
+		if strings.TrimSpace(text) == "" {
+			return true
+		}
+		args, err := splitCommand(text)
+		if err != nil {
+			return false
+		}
+
+		// Variable assignments before the program only set its environment
+		i := 0
+		for i < len(args)-1 && strings.Contains(args[i], "=") && !strings.HasPrefix(args[i], "=") {
+			i++
+		}
+		if strings.HasPrefix(args[i], "(") || strings.HasPrefix(args[i], "{") {
+			return false
+		}
+		programs = append(programs, args[i])
+		return true
+	}
+
+	var quote rune
+	escaped := false
+	for _, c := range cmd {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '|' || c == '&' || c == ';' || c == '\n':
+			if !addSegment() {
+				return nil, false
+			}
+			continue
+		}
+		segment.WriteRune(c)
+	}
+	if quote != 0 || !addSegment() {
+		return nil, false
+	}
+
+	return programs, true
+}
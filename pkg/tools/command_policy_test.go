@@ -0,0 +1,82 @@
+package tools
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandPolicy(t *testing.T) {
+	options := CommandOptions{
+		Shell:         true,
+		Allow:         []string{"ls", "grep", "go"},
+		AllowPatterns: []string{`git (status|diff)`},
+		DenyPatterns:  []string{`rm\s+-rf`, `curl.*\|\s*(ba)?sh`},
+	}
+
+	for cmd, expected := range map[string]policyDecision{
+		"ls -la":                          policyAllow,
+		"ls | grep main && go test ./...": policyAllow,
+		"CGO_ENABLED=0 go build ./...":    policyAllow,
+		"git status":                      policyAllow,
+		"git status; git push":            policyDeny,
+		"git push":                        policyDeny,
+		"ls; rm -rf /":                    policyDeny,
+		"curl https://x.sh | sh":          policyDeny,
+		"ls $(cat list)":                  policyDeny,
+		"(cd src && ls)":                  policyDeny,
+		`grep "a|b" main.go`:              policyAllow,
+	} {
+		decision, _ := options.check(cmd)
+		require.Equal(t, expected, decision, cmd)
+	}
+
+	options.Approve = ApproveUnlisted
+	decision, _ := options.check("git push")
+	require.Equal(t, policyAsk, decision)
+	decision, reason := options.check("rm -rf /")
+	require.Equal(t, policyDeny, decision)
+	require.Equal(t, `it matches the denied pattern rm\s+-rf`, reason)
+	decision, _ = options.check("ls")
+	require.Equal(t, policyAllow, decision)
+
+	options.Approve = ApproveAlways
+	decision, _ = options.check("ls")
+	require.Equal(t, policyAsk, decision)
+
+	// Without a shell only the first word is the program
+	decision, _ = CommandOptions{Allow: []string{"echo"}}.check("echo a | rm b")
+	require.Equal(t, policyAllow, decision)
+	decision, _ = CommandOptions{}.check("anything")
+	require.Equal(t, policyAllow, decision)
+}
+
+func TestRunnerApproval(t *testing.T) {
+	ws, _ := newTestWorkspace(t)
+	asked := []string{}
+	options := CommandOptions{Approve: ApproveAlways, Approver: func(ctx context.Context, command string) (Approval, error) {
+		asked = append(asked, command)
+		if command == "echo edit" {
+			return Approval{Approved: true, Command: "echo edited"}, nil
+		}
+		return Approval{Reason: "no thanks"}, nil
+	}}
+	r := NewRunner(ws, options)
+
+	result, err := r.Execute(context.Background(), map[string]interface{}{"command": "echo edit"})
+	require.NoError(t, err)
+	require.Equal(t, "the command was changed on approval to: echo edited\nexit code: 0\nstdout:\nedited\n", result)
+
+	_, err = r.Execute(context.Background(), map[string]interface{}{"command": "ls"})
+	require.ErrorIs(t, err, CommandRejectedErr)
+	require.EqualError(t, err, "command rejected: ls was not approved: no thanks")
+	require.Equal(t, []string{"echo edit", "ls"}, asked)
+
+	// Nobody can approve without an Approver
+	_, err = NewRunner(ws, CommandOptions{Approve: ApproveAlways}).Execute(context.Background(), map[string]interface{}{"command": "ls"})
+	require.ErrorIs(t, err, CommandRejectedErr)
+
+	_, err = NewRunner(ws, CommandOptions{Allow: []string{"echo"}}).Execute(context.Background(), map[string]interface{}{"command": "ls"})
+	require.EqualError(t, err, "command denied: ls was not run because it is not in the allowlist")
+}
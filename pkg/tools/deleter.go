@@ -0,0 +1,81 @@
+package tools
+
+import (
+	"clan/pkg/llm"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+type deleter struct {
+	workspace Workspace
+}
+
+func NewDeleter(workspace Workspace) Tool {
+	return &deleter{workspace: workspace}
+}
+
+func (d *deleter) Name() string {
+	return "Deleter"
+}
+
+func (d *deleter) Schema() llm.Tool {
+	return llm.Tool{
+		Name:        d.Name(),
+		Description: "Delete a file or an empty directory, or a directory and everything in it when recursive is true",
+		Schema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"filepath": map[string]interface{}{
+					"type":        "string",
+					"description": "Location of the file or directory, relative to the workspace",
+				},
+				"recursive": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Delete a directory and everything in it",
+				},
+			},
+			"required": []string{"filepath"},
+		},
+	}
+}
+
+func (d *deleter) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	fp, err := stringParam(params, "filepath")
+	if err != nil {
+		return "", err
+	}
+	recursive, err := boolParam(params, "recursive")
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := d.workspace.ResolveEntry(fp)
+	if err != nil {
+		return "", err
+	}
+	root, err := d.workspace.Resolve(".")
+	if err != nil {
+		return "", err
+	}
+	if resolved == root {
+		return "", errors.New("the workspace itself cannot be deleted")
+	}
+
+	_, err = os.Lstat(resolved)
+	if err != nil {
+		return "", err
+	}
+
+	if recursive {
+		err = os.RemoveAll(resolved)
+	} else {
+		err = os.Remove(resolved)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Deleted %s", fp), nil
+}
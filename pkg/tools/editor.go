@@ -0,0 +1,106 @@
+package tools
+
+import (
+	"clan/pkg/llm"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type editor struct {
+	workspace Workspace
+}
+
+// NewEditor returns a tool that replaces text in a file, so that agents
+// don't need to rewrite large files to change a few lines
+func NewEditor(workspace Workspace) Tool {
+	return &editor{workspace: workspace}
+}
+
+func (e *editor) Name() string {
+	return "Editor"
+}
+
+func (e *editor) Schema() llm.Tool {
+	return llm.Tool{
+		Name:        e.Name(),
+		Description: "Edit a file by replacing an exact piece of text with new text. The text must appear exactly once unless replace_all is true.",
+		Schema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"filepath": map[string]interface{}{
+					"type":        "string",
+					"description": "Location of the file, relative to the workspace",
+				},
+				"old_text": map[string]interface{}{
+					"type":        "string",
+					"description": "Text to replace, including enough surrounding lines to identify it",
+				},
+				"new_text": map[string]interface{}{
+					"type":        "string",
+					"description": "Text to replace it with",
+				},
+				"replace_all": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Replace every occurrence instead of exactly one",
+				},
+			},
+			"required": []string{"filepath", "old_text", "new_text"},
+		},
+	}
+}
+
+func (e *editor) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	fp, err := stringParam(params, "filepath")
+	if err != nil {
+		return "", err
+	}
+	oldText, err := stringParam(params, "old_text")
+	if err != nil {
+		return "", err
+	}
+	newText, err := stringParam(params, "new_text")
+	if err != nil {
+		return "", err
+	}
+	replaceAll, err := boolParam(params, "replace_all")
+	if err != nil {
+		return "", err
+	}
+
+	if oldText == "" {
+		return "", errors.New("old_text must not be empty")
+	}
+
+	resolved, err := e.workspace.ResolveWritable(fp)
+	if err != nil {
+		return "", err
+	}
+
+	fileBytes, err := os.ReadFile(resolved)
+	if err != nil {
+		return "", err
+	}
+	content := string(fileBytes)
+
+	count := strings.Count(content, oldText)
+	switch {
+	case count == 0:
+		return "", fmt.Errorf("old_text was not found in %s", fp)
+	case count > 1 && !replaceAll:
+		return "", fmt.Errorf("old_text appears %d times in %s, add surrounding lines to identify one or set replace_all", count, fp)
+	}
+
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(resolved, []byte(strings.ReplaceAll(content, oldText, newText)), info.Mode().Perm())
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Replaced %d occurrence(s) in %s", count, fp), nil
+}
@@ -0,0 +1,222 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readWorkspaceFile(t *testing.T, ws Workspace, p string) string {
+	fileBytes, err := os.ReadFile(filepath.Join(ws.Root, p))
+	require.NoError(t, err)
+	return string(fileBytes)
+}
+
+func TestWriterCreatesParentsAndAppends(t *testing.T) {
+	ws, _ := newTestWorkspace(t)
+	w := NewWriter(ws)
+
+	_, err := w.Execute(context.Background(), map[string]interface{}{"filepath": "a/b/c.txt", "content": "one\n"})
+	require.NoError(t, err)
+	_, err = w.Execute(context.Background(), map[string]interface{}{"filepath": "a/b/c.txt", "content": "two\n", "mode": "append"})
+	require.NoError(t, err)
+	require.Equal(t, "one\ntwo\n", readWorkspaceFile(t, ws, "a/b/c.txt"))
+
+	_, err = w.Execute(context.Background(), map[string]interface{}{"filepath": "a/b/c.txt", "content": "three\n"})
+	require.NoError(t, err)
+	require.Equal(t, "three\n", readWorkspaceFile(t, ws, "a/b/c.txt"))
+
+	_, err = w.Execute(context.Background(), map[string]interface{}{"filepath": "a/b/c.txt", "content": "x", "mode": "prepend"})
+	require.ErrorContains(t, err, "unknown mode prepend")
+
+	_, err = w.Execute(context.Background(), map[string]interface{}{"filepath": "a/b/c.txt"})
+	require.EqualError(t, err, "missing parameter content")
+}
+
+func TestReaderRequiresFilepath(t *testing.T) {
+	ws, _ := newTestWorkspace(t)
+	r := NewReader(ws)
+
+	_, err := r.Execute(context.Background(), map[string]interface{}{"filepath": 1})
+	require.EqualError(t, err, "parameter filepath must be a string")
+	_, err = r.Execute(context.Background(), map[string]interface{}{})
+	require.EqualError(t, err, "missing parameter filepath")
+}
+
+func TestEditor(t *testing.T) {
+	ws, _ := newTestWorkspace(t)
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root, "app.py"), []byte("x = 1\ny = 1\nprint(x)\n"), 0644))
+	e := NewEditor(ws)
+
+	result, err := e.Execute(context.Background(), map[string]interface{}{"filepath": "app.py", "old_text": "x = 1", "new_text": "x = 2"})
+	require.NoError(t, err)
+	require.Equal(t, "Replaced 1 occurrence(s) in app.py", result)
+	require.Equal(t, "x = 2\ny = 1\nprint(x)\n", readWorkspaceFile(t, ws, "app.py"))
+
+	_, err = e.Execute(context.Background(), map[string]interface{}{"filepath": "app.py", "old_text": "= ", "new_text": "="})
+	require.ErrorContains(t, err, "old_text appears 2 times")
+
+	_, err = e.Execute(context.Background(), map[string]interface{}{"filepath": "app.py", "old_text": "= ", "new_text": "=", "replace_all": true})
+	require.NoError(t, err)
+	require.Equal(t, "x =2\ny =1\nprint(x)\n", readWorkspaceFile(t, ws, "app.py"))
+
+	_, err = e.Execute(context.Background(), map[string]interface{}{"filepath": "app.py", "old_text": "z", "new_text": "w"})
+	require.ErrorContains(t, err, "old_text was not found in app.py")
+
+	ws.ReadOnly = true
+	_, err = NewEditor(ws).Execute(context.Background(), map[string]interface{}{"filepath": "app.py", "old_text": "x", "new_text": "z"})
+	require.ErrorIs(t, err, ReadOnlyWorkspaceErr)
+}
+
+func TestDeleter(t *testing.T) {
+	ws, outside := newTestWorkspace(t)
+	d := NewDeleter(ws)
+
+	_, err := d.Execute(context.Background(), map[string]interface{}{"filepath": "src"})
+	require.Error(t, err, "non empty directories need recursive")
+
+	_, err = d.Execute(context.Background(), map[string]interface{}{"filepath": "src", "recursive": true})
+	require.NoError(t, err)
+	require.NoDirExists(t, filepath.Join(ws.Root, "src"))
+
+	// Deleting a link leaves its target alone
+	require.NoError(t, os.Symlink(outside, filepath.Join(ws.Root, "link")))
+	_, err = d.Execute(context.Background(), map[string]interface{}{"filepath": "link", "recursive": true})
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(outside, "secret"))
+
+	for _, p := range []string{".", "", "../outside"} {
+		_, err = d.Execute(context.Background(), map[string]interface{}{"filepath": p, "recursive": true})
+		require.Error(t, err, p)
+	}
+	require.DirExists(t, ws.Root)
+	require.DirExists(t, outside)
+}
+
+func TestMover(t *testing.T) {
+	ws, _ := newTestWorkspace(t)
+	m := NewMover(ws)
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root, "other.py"), []byte("print(2)"), 0644))
+
+	_, err := m.Execute(context.Background(), map[string]interface{}{"source": "src/main.py", "destination": "lib/app/main.py"})
+	require.NoError(t, err)
+	require.Equal(t, "print(1)", readWorkspaceFile(t, ws, "lib/app/main.py"))
+	require.NoFileExists(t, filepath.Join(ws.Root, "src", "main.py"))
+
+	_, err = m.Execute(context.Background(), map[string]interface{}{"source": "other.py", "destination": "lib/app/main.py"})
+	require.ErrorContains(t, err, "already exists")
+	_, err = m.Execute(context.Background(), map[string]interface{}{"source": "other.py", "destination": "lib/app/main.py", "overwrite": true})
+	require.NoError(t, err)
+	require.Equal(t, "print(2)", readWorkspaceFile(t, ws, "lib/app/main.py"))
+
+	_, err = m.Execute(context.Background(), map[string]interface{}{"source": "lib", "destination": "../outside/lib"})
+	require.ErrorIs(t, err, OutsideWorkspaceErr)
+}
+
+func TestPatcher(t *testing.T) {
+	ws, _ := newTestWorkspace(t)
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root, "app.py"), []byte("import os\n\ndef main():\n    print(1)\n\nmain()\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root, "old.txt"), []byte("remove me\n"), 0644))
+
+	patch := `diff --git a/app.py b/app.py
+--- a/app.py
++++ b/app.py
+@@ -3,2 +3,3 @@
+ def main():
+-    print(1)
++    print(2)
++    print(3)
+--- /dev/null
++++ b/docs/notes.md
+@@ -0,0 +1,2 @@
++# Notes
++No newline
+\ No newline at end of file
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-remove me
+`
+	result, err := NewPatcher(ws).Execute(context.Background(), map[string]interface{}{"patch": patch})
+	require.NoError(t, err)
+	require.Equal(t, "Patch applied: patched app.py, created docs/notes.md, deleted old.txt", result)
+	require.Equal(t, "import os\n\ndef main():\n    print(2)\n    print(3)\n\nmain()\n", readWorkspaceFile(t, ws, "app.py"))
+	require.Equal(t, "# Notes\nNo newline", readWorkspaceFile(t, ws, "docs/notes.md"))
+	require.NoFileExists(t, filepath.Join(ws.Root, "old.txt"))
+}
+
+func TestPatcherFindsMovedHunks(t *testing.T) {
+	ws, _ := newTestWorkspace(t)
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root, "list.txt"), []byte("zero\none\ntwo\nthree\nfour\n"), 0644))
+
+	// The header is one line off
+	patch := `--- list.txt
++++ list.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+`
+	_, err := NewPatcher(ws).Execute(context.Background(), map[string]interface{}{"patch": patch})
+	require.NoError(t, err)
+	require.Equal(t, "zero\none\nTWO\nthree\nfour\n", readWorkspaceFile(t, ws, "list.txt"))
+}
+
+func TestPatcherChecksEveryFileFirst(t *testing.T) {
+	ws, _ := newTestWorkspace(t)
+
+	patch := `--- /dev/null
++++ new.txt
+@@ -0,0 +1 @@
++new
+--- src/main.py
++++ src/main.py
+@@ -1 +1 @@
+-print(5)
++print(6)
+`
+	_, err := NewPatcher(ws).Execute(context.Background(), map[string]interface{}{"patch": patch})
+	require.ErrorContains(t, err, "src/main.py: hunk 1 does not match the file around line 1")
+	require.NoFileExists(t, filepath.Join(ws.Root, "new.txt"))
+
+	_, err = NewPatcher(ws).Execute(context.Background(), map[string]interface{}{"patch": "--- /dev/null\n+++ src/main.py\n@@ -0,0 +1 @@\n+x\n"})
+	require.ErrorContains(t, err, "src/main.py already exists")
+
+	// Moving a file over another one is rejected like creating it
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root, "other.py"), []byte("print(7)\n"), 0644))
+	_, err = NewPatcher(ws).Execute(context.Background(), map[string]interface{}{"patch": "--- a/other.py\n+++ b/src/main.py\n@@ -1 +1 @@\n-print(7)\n+print(8)\n"})
+	require.ErrorContains(t, err, "src/main.py already exists and cannot be replaced by other.py")
+	require.Equal(t, "print(7)\n", readWorkspaceFile(t, ws, "other.py"))
+	require.Equal(t, "print(1)", readWorkspaceFile(t, ws, "src/main.py"))
+
+	// Files may only appear once and are only deleted when no line is left
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root, "twice.txt"), []byte("one\ntwo\n"), 0644))
+	_, err = NewPatcher(ws).Execute(context.Background(), map[string]interface{}{"patch": "--- twice.txt\n+++ twice.txt\n@@ -1 +1 @@\n-one\n+ONE\n--- twice.txt\n+++ moved.txt\n@@ -2 +2 @@\n-two\n+TWO\n"})
+	require.ErrorIs(t, err, InvalidPatchErr)
+	require.ErrorContains(t, err, "twice.txt is changed more than once")
+	_, err = NewPatcher(ws).Execute(context.Background(), map[string]interface{}{"patch": "--- twice.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-one\n"})
+	require.ErrorIs(t, err, InvalidPatchErr)
+	require.ErrorContains(t, err, "twice.txt is deleted but the patch does not remove all of its lines")
+	require.Equal(t, "one\ntwo\n", readWorkspaceFile(t, ws, "twice.txt"))
+
+	// A file that cannot be written leaves every other file as it was
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root, "blocked"), []byte("a file\n"), 0644))
+	_, err = NewPatcher(ws).Execute(context.Background(), map[string]interface{}{"patch": "--- twice.txt\n+++ twice.txt\n@@ -1 +1 @@\n-one\n+ONE\n--- /dev/null\n+++ blocked/new.txt\n@@ -0,0 +1 @@\n+new\n"})
+	require.Error(t, err)
+	require.Equal(t, "one\ntwo\n", readWorkspaceFile(t, ws, "twice.txt"))
+	entries, err := os.ReadDir(ws.Root)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.False(t, strings.HasPrefix(entry.Name(), "."), entry.Name())
+	}
+
+	for _, patch := range []string{"not a patch", "--- a.txt\n@@ -1 +1 @@\n", "--- a.txt\n+++ a.txt\n@@ -1,3 +1,3 @@\n-x\n+y\n"} {
+		_, err = NewPatcher(ws).Execute(context.Background(), map[string]interface{}{"patch": patch})
+		require.ErrorIs(t, err, InvalidPatchErr, patch)
+	}
+}
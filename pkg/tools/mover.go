@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"clan/pkg/llm"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+type mover struct {
+	workspace Workspace
+}
+
+func NewMover(workspace Workspace) Tool {
+	return &mover{workspace: workspace}
+}
+
+func (m *mover) Name() string {
+	return "Mover"
+}
+
+func (m *mover) Schema() llm.Tool {
+	return llm.Tool{
+		Name:        m.Name(),
+		Description: "Move or rename a file or directory. Missing parent directories of the destination are created.",
+		Schema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"source": map[string]interface{}{
+					"type":        "string",
+					"description": "Location of the file or directory to move, relative to the workspace",
+				},
+				"destination": map[string]interface{}{
+					"type":        "string",
+					"description": "New location, relative to the workspace",
+				},
+				"overwrite": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Replace the destination when it already exists",
+				},
+			},
+			"required": []string{"source", "destination"},
+		},
+	}
+}
+
+func (m *mover) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	source, err := stringParam(params, "source")
+	if err != nil {
+		return "", err
+	}
+	destination, err := stringParam(params, "destination")
+	if err != nil {
+		return "", err
+	}
+	overwrite, err := boolParam(params, "overwrite")
+	if err != nil {
+		return "", err
+	}
+
+	from, err := m.workspace.ResolveEntry(source)
+	if err != nil {
+		return "", err
+	}
+	to, err := m.workspace.ResolveEntry(destination)
+	if err != nil {
+		return "", err
+	}
+
+	root, err := m.workspace.Resolve(".")
+	if err != nil {
+		return "", err
+	}
+	if from == root {
+		return "", errors.New("the workspace itself cannot be moved")
+	}
+
+	_, err = os.Lstat(from)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = os.Lstat(to)
+	if err == nil && !overwrite {
+		return "", fmt.Errorf("%s already exists, set overwrite to replace it", destination)
+	}
+
+	err = os.MkdirAll(filepath.Dir(to), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.Rename(from, to)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Moved %s to %s", source, destination), nil
+}
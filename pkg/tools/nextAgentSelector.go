@@ -2,6 +2,7 @@ package tools
 
 import (
 	"clan/pkg/llm"
+	"context"
 )
 
 type nextAgentSelector struct{}
@@ -34,7 +35,6 @@ func (nas *nextAgentSelector) Schema() llm.Tool {
 	}
 }
 
-func (nas *nextAgentSelector) Execute(params map[string]interface{}) (string, error) {
-	taskSummary := params["summary"].(string)
-	return string(taskSummary), nil
+func (nas *nextAgentSelector) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	return stringParam(params, "summary")
 }
@@ -0,0 +1,483 @@
+package tools
+
+import (
+	"clan/pkg/llm"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var InvalidPatchErr = errors.New("invalid patch")
+
+const devNull = "/dev/null"
+
+type patcher struct {
+	workspace Workspace
+}
+
+// NewPatcher returns a tool that applies unified diffs. Every file of the
+// diff is checked before any of them is changed, and the diff is either
+// applied to all of them or to none.
+func NewPatcher(workspace Workspace) Tool {
+	return &patcher{workspace: workspace}
+}
+
+func (p *patcher) Name() string {
+	return "Patcher"
+}
+
+func (p *patcher) Schema() llm.Tool {
+	return llm.Tool{
+		Name:        p.Name(),
+		Description: "Apply a unified diff, as produced by diff -u or git diff, to files in the workspace. Files can be changed, created from /dev/null or deleted to /dev/null.",
+		Schema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"patch": map[string]interface{}{
+					"type":        "string",
+					"description": "Unified diff with --- and +++ headers and @@ hunks. Paths are relative to the workspace, a/ and b/ prefixes are ignored.",
+				},
+			},
+			"required": []string{"patch"},
+		},
+	}
+}
+
+func (p *patcher) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	patch, err := stringParam(params, "patch")
+	if err != nil {
+		return "", err
+	}
+
+	filePatches, err := parsePatch(patch)
+	if err != nil {
+		return "", err
+	}
+
+	changes := []patchChange{}
+	touched := map[string]bool{}
+	for _, fp := range filePatches {
+		c := patchChange{mode: 0644}
+		original := ""
+		if fp.oldPath != devNull {
+			c.from, err = p.workspace.ResolveWritable(fp.oldPath)
+			if err != nil {
+				return "", err
+			}
+			fileBytes, err := os.ReadFile(c.from)
+			if err != nil {
+				return "", err
+			}
+			info, err := os.Stat(c.from)
+			if err != nil {
+				return "", err
+			}
+			original = string(fileBytes)
+			c.mode = info.Mode().Perm()
+		}
+
+		if fp.newPath != devNull {
+			c.to, err = p.workspace.ResolveWritable(fp.newPath)
+			if err != nil {
+				return "", err
+			}
+			// Created and moved files never replace an existing one
+			_, statErr := os.Lstat(c.to)
+			if fp.oldPath == devNull && statErr == nil {
+				return "", fmt.Errorf("%s already exists and cannot be created", fp.newPath)
+			}
+			if c.from != "" && c.from != c.to && statErr == nil {
+				return "", fmt.Errorf("%s already exists and cannot be replaced by %s", fp.newPath, fp.oldPath)
+			}
+		}
+
+		for _, path := range c.paths() {
+			if touched[path] {
+				name := fp.newPath
+				if path == c.from {
+					name = fp.oldPath
+				}
+				return "", fmt.Errorf("%w: %s is changed more than once", InvalidPatchErr, name)
+			}
+			touched[path] = true
+		}
+
+		c.content, err = applyHunks(original, fp.hunks)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", fp.name(), err)
+		}
+		if c.to == "" && c.content != "" {
+			return "", fmt.Errorf("%w: %s is deleted but the patch does not remove all of its lines", InvalidPatchErr, fp.name())
+		}
+		changes = append(changes, c)
+	}
+
+	err = applyChanges(changes)
+	if err != nil {
+		return "", err
+	}
+
+	summary := []string{}
+	for i, c := range changes {
+		switch {
+		case c.from == "":
+			summary = append(summary, fmt.Sprintf("created %s", filePatches[i].newPath))
+		case c.to == "":
+			summary = append(summary, fmt.Sprintf("deleted %s", filePatches[i].oldPath))
+		case c.from != c.to:
+			summary = append(summary, fmt.Sprintf("moved %s to %s", filePatches[i].oldPath, filePatches[i].newPath))
+		default:
+			summary = append(summary, fmt.Sprintf("patched %s", filePatches[i].newPath))
+		}
+	}
+
+	return fmt.Sprintf("Patch applied: %s", strings.Join(summary, ", ")), nil
+}
+
+// patchChange moves the file from, if any, to the file to with content. An
+// empty to deletes the file.
+type patchChange struct {
+	from    string
+	to      string
+	content string
+	mode    os.FileMode
+	temp    string
+}
+
+// paths returns the files the change replaces, creates or removes
+func (c patchChange) paths() []string {
+	paths := []string{}
+	if c.from != "" {
+		paths = append(paths, c.from)
+	}
+	if c.to != "" && c.to != c.from {
+		paths = append(paths, c.to)
+	}
+	return paths
+}
+
+// applyChanges writes every change to a temporary file next to its target
+// and moves the files it replaces or removes aside before moving the new ones
+// into place, so that a failure restores the workspace as it was
+func applyChanges(changes []patchChange) (err error) {
+	type backup struct {
+		path string
+		temp string
+	}
+	backups := []backup{}
+	installed := []string{}
+	defer func() {
+		if err == nil {
+			for _, b := range backups {
+				os.Remove(b.temp)
+			}
+			return
+		}
+
+		for _, path := range installed {
+			os.Remove(path)
+		}
+		for _, c := range changes {
+			if c.temp != "" {
+				os.Remove(c.temp)
+			}
+		}
+		for i := len(backups) - 1; i >= 0; i-- {
+			os.Rename(backups[i].temp, backups[i].path)
+		}
+	}()
+
+	for i := range changes {
+		c := &changes[i]
+		if c.to == "" {
+			continue
+		}
+
+		err = os.MkdirAll(filepath.Dir(c.to), 0755)
+		if err != nil {
+			return err
+		}
+		c.temp, err = writeTemp(c.to, ".patch", []byte(c.content), c.mode)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, c := range changes {
+		for _, path := range c.paths() {
+			if _, statErr := os.Lstat(path); statErr != nil {
+				continue
+			}
+
+			b := backup{path: path}
+			b.temp, err = writeTemp(path, ".orig", nil, 0600)
+			if err != nil {
+				return err
+			}
+			err = os.Rename(path, b.temp)
+			if err != nil {
+				os.Remove(b.temp)
+				return err
+			}
+			backups = append(backups, b)
+		}
+	}
+
+	for i := range changes {
+		c := &changes[i]
+		if c.to == "" {
+			continue
+		}
+
+		err = os.Rename(c.temp, c.to)
+		if err != nil {
+			return err
+		}
+		c.temp = ""
+		installed = append(installed, c.to)
+	}
+
+	return nil
+}
+
+// writeTemp writes content to a new hidden file in the directory of path
+func writeTemp(path string, suffix string, content []byte, mode os.FileMode) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+suffix+"-*")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = f.Write(content)
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+type filePatch struct {
+	oldPath string
+	newPath string
+	hunks   []hunk
+}
+
+func (fp filePatch) name() string {
+	if fp.newPath != devNull {
+		return fp.newPath
+	}
+	return fp.oldPath
+}
+
+// hunk holds the lines of a hunk with their ' ', '-' or '+' prefix
+type hunk struct {
+	oldStart int
+	lines    []string
+	// oldNoEOL and newNoEOL are set by "\ No newline at end of file"
+	oldNoEOL bool
+	newNoEOL bool
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+func parsePatch(patch string) ([]filePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n")
+	filePatches := []filePatch{}
+
+	i := 0
+	for i < len(lines) {
+		if !strings.HasPrefix(lines[i], "--- ") {
+			// git headers and other text between files are ignored
+			i++
+			continue
+		}
+		if i+1 >= len(lines) || !strings.HasPrefix(lines[i+1], "+++ ") {
+			return nil, fmt.Errorf("%w: line %d: expected +++ after ---", InvalidPatchErr, i+2)
+		}
+
+		fp := filePatch{oldPath: patchPath(lines[i][4:], "a/"), newPath: patchPath(lines[i+1][4:], "b/")}
+		if fp.oldPath == devNull && fp.newPath == devNull {
+			return nil, fmt.Errorf("%w: line %d: both files are /dev/null", InvalidPatchErr, i+1)
+		}
+		i += 2
+
+		for i < len(lines) && strings.HasPrefix(lines[i], "@@") {
+			match := hunkHeader.FindStringSubmatch(lines[i])
+			if match == nil {
+				return nil, fmt.Errorf("%w: line %d: malformed hunk header %s", InvalidPatchErr, i+1, lines[i])
+			}
+			h := hunk{}
+			h.oldStart, _ = strconv.Atoi(match[1])
+			oldCount, newCount := 1, 1
+			if match[2] != "" {
+				oldCount, _ = strconv.Atoi(match[2])
+			}
+			if match[4] != "" {
+				newCount, _ = strconv.Atoi(match[4])
+			}
+			i++
+
+			for i < len(lines) && (oldCount > 0 || newCount > 0 || strings.HasPrefix(lines[i], `\`)) {
+				line := lines[i]
+				// Editors often strip the space of empty context lines
+				if line == "" {
+					line = " "
+				}
+
+				switch line[0] {
+				case ' ':
+					oldCount--
+					newCount--
+				case '-':
+					oldCount--
+				case '+':
+					newCount--
+				case '\\':
+					if len(h.lines) > 0 {
+						switch h.lines[len(h.lines)-1][0] {
+						case '-':
+							h.oldNoEOL = true
+						case '+':
+							h.newNoEOL = true
+						default:
+							h.oldNoEOL = true
+							h.newNoEOL = true
+						}
+					}
+					i++
+					continue
+				default:
+					return nil, fmt.Errorf("%w: line %d: unexpected line in hunk", InvalidPatchErr, i+1)
+				}
+				h.lines = append(h.lines, line)
+				i++
+			}
+
+			if oldCount != 0 || newCount != 0 {
+				return nil, fmt.Errorf("%w: hunk for %s is shorter than its header", InvalidPatchErr, fp.name())
+			}
+			fp.hunks = append(fp.hunks, h)
+		}
+
+		if len(fp.hunks) == 0 {
+			return nil, fmt.Errorf("%w: no hunks for %s", InvalidPatchErr, fp.name())
+		}
+		filePatches = append(filePatches, fp)
+	}
+
+	if len(filePatches) == 0 {
+		return nil, fmt.Errorf("%w: no --- and +++ file headers found", InvalidPatchErr)
+	}
+
+	return filePatches, nil
+}
+
+// patchPath removes the timestamp and the a/ or b/ prefix of a header path
+func patchPath(header string, prefix string) string {
+	p, _, _ := strings.Cut(header, "\t")
+	p = strings.TrimSpace(p)
+	if p == devNull {
+		return p
+	}
+	return strings.TrimPrefix(p, prefix)
+}
+
+// applyHunks applies the hunks in order. A hunk whose lines have moved is
+// searched for around the line given in its header.
+func applyHunks(content string, hunks []hunk) (string, error) {
+	fileLines := []string{}
+	endsWithNewline := true
+	if content != "" {
+		trimmed := strings.TrimSuffix(content, "\n")
+		endsWithNewline = trimmed != content
+		fileLines = strings.Split(trimmed, "\n")
+	}
+
+	offset := 0
+	minIndex := 0
+	for n, h := range hunks {
+		oldLines := []string{}
+		newLines := []string{}
+		for _, line := range h.lines {
+			if line[0] != '+' {
+				oldLines = append(oldLines, line[1:])
+			}
+			if line[0] != '-' {
+				newLines = append(newLines, line[1:])
+			}
+		}
+
+		expected := h.oldStart - 1 + offset
+		if len(oldLines) == 0 {
+			// Hunks that only add lines give the line they follow
+			expected = h.oldStart + offset
+		}
+		index := findLines(fileLines, oldLines, expected, minIndex)
+		if index < 0 {
+			return "", fmt.Errorf("hunk %d does not match the file around line %d", n+1, h.oldStart)
+		}
+
+		updated := append([]string{}, fileLines[:index]...)
+		updated = append(updated, newLines...)
+		updated = append(updated, fileLines[index+len(oldLines):]...)
+		fileLines = updated
+
+		offset += len(newLines) - len(oldLines)
+		minIndex = index + len(newLines)
+		if h.newNoEOL {
+			endsWithNewline = false
+		} else if h.oldNoEOL {
+			endsWithNewline = true
+		}
+	}
+
+	if len(fileLines) == 0 {
+		return "", nil
+	}
+
+	result := strings.Join(fileLines, "\n")
+	if endsWithNewline {
+		result += "\n"
+	}
+	return result, nil
+}
+
+// findLines returns the index of lines in fileLines closest to expected and
+// not before minIndex, or -1
+func findLines(fileLines []string, lines []string, expected int, minIndex int) int {
+	matches := func(index int) bool {
+		if index < minIndex || index+len(lines) > len(fileLines) {
+			return false
+		}
+		for i, line := range lines {
+			if fileLines[index+i] != line {
+				return false
+			}
+		}
+		return true
+	}
+
+	expected = max(minIndex, min(expected, len(fileLines)))
+	for distance := 0; distance <= len(fileLines); distance++ {
+		if matches(expected - distance) {
+			return expected - distance
+		}
+		if matches(expected + distance) {
+			return expected + distance
+		}
+	}
+
+	return -1
+}
@@ -2,14 +2,16 @@ package tools
 
 import (
 	"clan/pkg/llm"
+	"context"
 	"os"
-	"path"
 )
 
-type reader struct{}
+type reader struct {
+	workspace Workspace
+}
 
-func NewReader() Tool {
-	return &reader{}
+func NewReader(workspace Workspace) Tool {
+	return &reader{workspace: workspace}
 }
 
 func (r *reader) Name() string {
@@ -25,16 +27,24 @@ func (r *reader) Schema() llm.Tool {
 			"properties": map[string]interface{}{
 				"filepath": map[string]interface{}{
 					"type":        "string",
-					"description": "Location of the file in the filesystem",
+					"description": "Location of the file, relative to the workspace",
 				},
 			},
 		},
 	}
 }
 
-func (r *reader) Execute(params map[string]interface{}) (string, error) {
-	fp := params["filepath"].(string)
-	fp = path.Join("./workspace", fp)
+func (r *reader) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	path, err := stringParam(params, "filepath")
+	if err != nil {
+		return "", err
+	}
+
+	fp, err := r.workspace.Resolve(path)
+	if err != nil {
+		return "", err
+	}
+
 	fileBytes, err := os.ReadFile(fp)
 	if err != nil {
 		return "", err
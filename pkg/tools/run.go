@@ -2,14 +2,94 @@ package tools
 
 import (
 	"clan/pkg/llm"
+	"context"
+	"errors"
+	"fmt"
+	"os"
 	"os/exec"
 	"strings"
+	"time"
 )
 
-type runner struct{}
+var CommandTimeoutErr = errors.New("command timed out")
 
-func NewRunner() Tool {
-	return &runner{}
+const (
+	DefaultCommandTimeout    = 2 * time.Minute
+	DefaultCommandMaxTimeout = 10 * time.Minute
+	// DefaultCommandMaxOutput is the number of bytes kept of stdout and of
+	// stderr
+	DefaultCommandMaxOutput = 32 * 1024
+)
+
+// CommandOptions configures the CommandRunner of an agent. The zero value
+// splits commands into arguments without a shell and uses the defaults.
+type CommandOptions struct {
+	// Shell runs commands with sh -c so that pipes, redirects, && and
+	// variables work
+	Shell bool `yaml:"shell"`
+	// Timeout is used when a call doesn't set one, DefaultCommandTimeout
+	// when zero
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxTimeout bounds the timeout a call may ask for,
+	// DefaultCommandMaxTimeout when zero
+	MaxTimeout time.Duration `yaml:"max_timeout"`
+	// MaxOutputBytes is the number of bytes kept of stdout and of stderr,
+	// DefaultCommandMaxOutput when zero
+	MaxOutputBytes int `yaml:"max_output_bytes"`
+	// Dir is the working directory relative to the workspace, the workspace
+	// itself when empty
+	Dir string `yaml:"dir"`
+	// Env is added to the environment clan runs with, or replaces it in a
+	// sandbox
+	Env map[string]string `yaml:"env"`
+
+	// Allow lists the programs commands may run, everything when Allow and
+	// AllowPatterns are empty
+	Allow []string `yaml:"allow"`
+	// AllowPatterns are regular expressions matching whole commands that may
+	// run
+	AllowPatterns []string `yaml:"allow_patterns"`
+	// DenyPatterns are regular expressions matching commands that never run,
+	// even when allowed
+	DenyPatterns []string `yaml:"deny_patterns"`
+	// Approve is ApproveAlways or ApproveUnlisted to ask Approver before
+	// running commands, empty to only apply the lists
+	Approve string `yaml:"approve"`
+	// Sandbox runs commands isolated from the host when set
+	Sandbox *SandboxOptions `yaml:"sandbox"`
+	// Approver is asked when Approve requires it. Commands needing approval
+	// are rejected when it is nil.
+	Approver Approver `yaml:"-"`
+}
+
+func (o CommandOptions) timeout() time.Duration {
+	if o.Timeout == 0 {
+		return DefaultCommandTimeout
+	}
+	return o.Timeout
+}
+
+func (o CommandOptions) maxTimeout() time.Duration {
+	if o.MaxTimeout == 0 {
+		return max(DefaultCommandMaxTimeout, o.timeout())
+	}
+	return o.MaxTimeout
+}
+
+func (o CommandOptions) maxOutput() int {
+	if o.MaxOutputBytes == 0 {
+		return DefaultCommandMaxOutput
+	}
+	return o.MaxOutputBytes
+}
+
+type runner struct {
+	workspace Workspace
+	options   CommandOptions
+}
+
+func NewRunner(workspace Workspace, options CommandOptions) Tool {
+	return &runner{workspace: workspace, options: options}
 }
 
 func (r *runner) Name() string {
@@ -17,31 +97,281 @@ func (r *runner) Name() string {
 }
 
 func (r *runner) Schema() llm.Tool {
+	command := "Command to run. Arguments can be quoted with ' or \", pipes, redirects and && are not supported."
+	if r.options.Shell {
+		command = "Command to run with sh -c"
+	}
+
 	return llm.Tool{
 		Name:        r.Name(),
-		Description: "Run commands such as listing files, installing software, running a program",
+		Description: "Run commands such as listing files, installing software, running a program. The exit code, stdout and stderr are returned.",
 		Schema: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
 				"command": map[string]interface{}{
 					"type":        "string",
-					"description": "Command to run",
+					"description": command,
+				},
+				"timeout_seconds": map[string]interface{}{
+					"type":        "number",
+					"description": fmt.Sprintf("Seconds after which the command is stopped, %g by default and at most %g", r.options.timeout().Seconds(), r.options.maxTimeout().Seconds()),
+				},
+				"working_dir": map[string]interface{}{
+					"type":        "string",
+					"description": "Directory to run the command in, relative to the workspace",
 				},
 			},
+			"required": []string{"command"},
 		},
 	}
 }
 
-func (r *runner) Execute(params map[string]interface{}) (string, error) {
-	cmd := params["command"].(string)
-	cmdArgs := strings.Split(cmd, " ")
-	command := exec.Command(cmdArgs[0], cmdArgs[1:]...)
-	command.Dir = "./workspace"
+func (r *runner) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	cmd, err := stringParam(params, "command")
+	if err != nil {
+		return "", err
+	}
+	timeoutSeconds, err := numberParam(params, "timeout_seconds")
+	if err != nil {
+		return "", err
+	}
+	workingDir, err := optionalStringParam(params, "working_dir")
+	if err != nil {
+		return "", err
+	}
+
+	note := ""
+	decision, reason := r.options.check(cmd)
+	switch decision {
+	case policyDeny:
+		return "", fmt.Errorf("%w: %s was not run because %s", CommandDeniedErr, cmd, reason)
+	case policyAsk:
+		if r.options.Approver == nil {
+			return "", fmt.Errorf("%w: %s needs approval and nobody can approve it", CommandRejectedErr, cmd)
+		}
+		approval, err := r.options.Approver(ctx, cmd)
+		if err != nil {
+			return "", err
+		}
+		if !approval.Approved {
+			if approval.Reason != "" {
+				return "", fmt.Errorf("%w: %s was not approved: %s", CommandRejectedErr, cmd, approval.Reason)
+			}
+			return "", fmt.Errorf("%w: %s was not approved", CommandRejectedErr, cmd)
+		}
+		if approval.Command != "" && approval.Command != cmd {
+			// The model is told so that it doesn't assume its command ran
+			note = fmt.Sprintf("the command was changed on approval to: %s\n", approval.Command)
+			cmd = approval.Command
+		}
+	}
+
+	args := []string{"sh", "-c", cmd}
+	if !r.options.Shell {
+		args, err = splitCommand(cmd)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	dir, err := r.dir(workingDir)
+	if err != nil {
+		return "", err
+	}
+
+	if r.options.Sandbox != nil {
+		root, err := r.workspace.Resolve(".")
+		if err != nil {
+			return "", err
+		}
+		args, err = sandboxCommand(*r.options.Sandbox, r.workspace, root, dir, r.options.Env, args)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	timeout := r.options.timeout()
+	if timeoutSeconds > 0 {
+		timeout = min(time.Duration(timeoutSeconds*float64(time.Second)), r.options.maxTimeout())
+	}
+	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stdout := newCappedBuffer(r.options.maxOutput())
+	stderr := newCappedBuffer(r.options.maxOutput())
+	command := exec.CommandContext(cmdCtx, args[0], args[1:]...)
+	command.Dir = dir
+	command.Env = os.Environ()
+	// Later values win over the ones inherited
+	for k, v := range r.options.Env {
+		command.Env = append(command.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+	command.Stdout = stdout
+	command.Stderr = stderr
+	// Children that keep the output open must not block the workflow once
+	// the command is stopped
+	command.WaitDelay = time.Second
+	setProcessGroup(command)
+
+	err = command.Run()
+	switch {
+	case ctx.Err() != nil:
+		return "", ctx.Err()
+	case cmdCtx.Err() != nil:
+		// The output shows how far the command got
+		return "", fmt.Errorf("%w after %s\n%s%s", CommandTimeoutErr, timeout, note, formatOutput(stdout, stderr))
+	}
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return "", err
+	}
+
+	// A failing command is reported with its output rather than as an error,
+	// so that the model can see why it failed
+	return fmt.Sprintf("%sexit code: %d\n%s", note, command.ProcessState.ExitCode(), formatOutput(stdout, stderr)), nil
+}
+
+// dir returns the directory commands run in, which must be within the
+// workspace
+func (r *runner) dir(workingDir string) (string, error) {
+	p := workingDir
+	if p == "" {
+		p = r.options.Dir
+	}
+	if p == "" {
+		p = "."
+	}
+	dir, err := r.workspace.Resolve(p)
+	if err != nil {
+		return "", err
+	}
 
-	output, err := command.CombinedOutput()
+	info, err := os.Stat(dir)
 	if err != nil {
 		return "", err
 	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+
+	return dir, nil
+}
+
+func formatOutput(stdout *cappedBuffer, stderr *cappedBuffer) string {
+	sb := strings.Builder{}
+	for _, stream := range []struct {
+		name string
+		b    *cappedBuffer
+	}{{"stdout", stdout}, {"stderr", stderr}} {
+		output := stream.b.String()
+		if output == "" {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("%s:\n%s", stream.name, output))
+		if !strings.HasSuffix(output, "\n") {
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// splitCommand splits cmd into arguments the way a shell would without
+// expanding anything. Quotes group words and a backslash escapes the next
+// character outside of single quotes.
+func splitCommand(cmd string) ([]string, error) {
+	args := []string{}
+	current := strings.Builder{}
+	inWord := false
+	var quote rune
+
+	runes := []rune(cmd)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(c)
+			}
+		case c == '\\' && (quote == 0 || (i+1 < len(runes) && strings.ContainsRune(`"\$`+"`", runes[i+1]))):
+			if i+1 == len(runes) {
+				return nil, errors.New("command ends with an unescaped backslash")
+			}
+			i++
+			current.WriteRune(runes[i])
+			inWord = true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				current.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				args = append(args, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(c)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in command", quote)
+	}
+	if inWord {
+		args = append(args, current.String())
+	}
+	if len(args) == 0 {
+		return nil, errors.New("command is empty")
+	}
+
+	return args, nil
+}
+
+// cappedBuffer keeps the beginning and the end of what is written to it,
+// up to limit bytes, and counts the bytes dropped in between
+type cappedBuffer struct {
+	limit   int
+	head    []byte
+	tail    []byte
+	dropped int
+}
 
-	return string(output), nil
+func newCappedBuffer(limit int) *cappedBuffer {
+	return &cappedBuffer{limit: limit}
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+
+	headLimit := b.limit / 2
+	if len(b.head) < headLimit {
+		count := min(headLimit-len(b.head), len(p))
+		b.head = append(b.head, p[:count]...)
+		p = p[count:]
+	}
+
+	b.tail = append(b.tail, p...)
+	tailLimit := b.limit - headLimit
+	if len(b.tail) > tailLimit {
+		b.dropped += len(b.tail) - tailLimit
+		b.tail = append(b.tail[:0], b.tail[len(b.tail)-tailLimit:]...)
+	}
+
+	return n, nil
+}
+
+func (b *cappedBuffer) String() string {
+	if b.dropped == 0 {
+		return string(b.head) + string(b.tail)
+	}
+	return fmt.Sprintf("%s\n[... %d bytes truncated ...]\n%s", b.head, b.dropped, b.tail)
 }
@@ -0,0 +1,106 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitCommand(t *testing.T) {
+	args, err := splitCommand(`grep -r "hello world" 'it''s' a\ b "say \"hi\"" src`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"grep", "-r", "hello world", "its", "a b", `say "hi"`, "src"}, args)
+
+	args, err = splitCommand(`echo "" end`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"echo", "", "end"}, args)
+
+	_, err = splitCommand(`echo "open`)
+	require.EqualError(t, err, `unterminated " quote in command`)
+	_, err = splitCommand("  ")
+	require.EqualError(t, err, "command is empty")
+}
+
+func TestRunnerKeepsOutputOfFailingCommands(t *testing.T) {
+	ws, _ := newTestWorkspace(t)
+
+	result, err := NewRunner(ws, CommandOptions{}).Execute(context.Background(), map[string]interface{}{"command": "cat src/main.py missing"})
+	require.NoError(t, err)
+	require.Contains(t, result, "exit code: 1\nstdout:\nprint(1)\nstderr:\n")
+	require.Contains(t, result, "missing")
+}
+
+func TestRunnerShell(t *testing.T) {
+	ws, _ := newTestWorkspace(t)
+	options := CommandOptions{Shell: true, Env: map[string]string{"GREETING": "hello"}}
+
+	result, err := NewRunner(ws, options).Execute(context.Background(), map[string]interface{}{"command": `echo "$GREETING" | tr a-z A-Z > out.txt && cat out.txt; echo oops >&2`})
+	require.NoError(t, err)
+	require.Equal(t, "exit code: 0\nstdout:\nHELLO\nstderr:\noops\n", result)
+
+	// Without a shell the operators are plain arguments
+	result, err = NewRunner(ws, CommandOptions{}).Execute(context.Background(), map[string]interface{}{"command": `echo "a b" | cat`})
+	require.NoError(t, err)
+	require.Equal(t, "exit code: 0\nstdout:\na b | cat\n", result)
+}
+
+func TestRunnerWorkingDir(t *testing.T) {
+	ws, _ := newTestWorkspace(t)
+	root, err := filepath.EvalSymlinks(ws.Root)
+	require.NoError(t, err)
+
+	result, err := NewRunner(ws, CommandOptions{Dir: "src"}).Execute(context.Background(), map[string]interface{}{"command": "pwd"})
+	require.NoError(t, err)
+	require.Equal(t, "exit code: 0\nstdout:\n"+filepath.Join(root, "src")+"\n", result)
+
+	result, err = NewRunner(ws, CommandOptions{Dir: "src"}).Execute(context.Background(), map[string]interface{}{"command": "pwd", "working_dir": "."})
+	require.NoError(t, err)
+	require.Equal(t, "exit code: 0\nstdout:\n"+root+"\n", result)
+
+	_, err = NewRunner(ws, CommandOptions{}).Execute(context.Background(), map[string]interface{}{"command": "pwd", "working_dir": "../outside"})
+	require.ErrorIs(t, err, OutsideWorkspaceErr)
+}
+
+func TestRunnerTimeout(t *testing.T) {
+	ws, _ := newTestWorkspace(t)
+	r := NewRunner(ws, CommandOptions{Shell: true, Timeout: 100 * time.Millisecond})
+
+	// The background sleep keeps stdout open after sh is stopped
+	start := time.Now()
+	_, err := r.Execute(context.Background(), map[string]interface{}{"command": "echo started; sleep 30 & sleep 30"})
+	require.ErrorIs(t, err, CommandTimeoutErr)
+	require.Contains(t, err.Error(), "stdout:\nstarted\n")
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	// Calls may ask for a longer timeout
+	result, err := r.Execute(context.Background(), map[string]interface{}{"command": "sleep 0.3", "timeout_seconds": 5})
+	require.NoError(t, err)
+	require.Equal(t, "exit code: 0\n", result)
+}
+
+func TestRunnerTruncatesOutput(t *testing.T) {
+	ws, _ := newTestWorkspace(t)
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root, "big.txt"), []byte(strings.Repeat("a", 50)+strings.Repeat("b", 50)), 0644))
+
+	result, err := NewRunner(ws, CommandOptions{MaxOutputBytes: 20}).Execute(context.Background(), map[string]interface{}{"command": "cat big.txt"})
+	require.NoError(t, err)
+	require.Equal(t, "exit code: 0\nstdout:\naaaaaaaaaa\n[... 80 bytes truncated ...]\nbbbbbbbbbb\n", result)
+}
+
+func TestCappedBuffer(t *testing.T) {
+	b := newCappedBuffer(6)
+	for _, s := range []string{"ab", "cd", "ef"} {
+		_, err := b.Write([]byte(s))
+		require.NoError(t, err)
+	}
+	require.Equal(t, "abcdef", b.String())
+
+	_, err := b.Write([]byte("ghij"))
+	require.NoError(t, err)
+	require.Equal(t, "abc\n[... 4 bytes truncated ...]\nhij", b.String())
+}
@@ -0,0 +1,40 @@
+package tools
+
+import "errors"
+
+var SandboxUnavailableErr = errors.New("sandbox is unavailable")
+
+const (
+	// SandboxBubblewrap runs commands with bwrap in new namespaces
+	SandboxBubblewrap = "bwrap"
+
+	// SandboxWorkspaceCopy gives every command a throwaway copy-on-write view
+	// of the workspace, its changes are discarded when it exits
+	SandboxWorkspaceCopy = "copy"
+	// SandboxWorkspaceWrite lets commands change the workspace
+	SandboxWorkspaceWrite = "write"
+)
+
+// SandboxOptions isolates the commands run by CommandRunner from the host.
+// Commands only see the system directories, read-only, and the workspace
+// mounted at SandboxWorkspaceDir. Limits are not applied when zero.
+type SandboxOptions struct {
+	// Type is the backend, SandboxBubblewrap when empty
+	Type string `yaml:"type"`
+	// Network gives commands access to the network, disabled by default
+	Network bool `yaml:"network"`
+	// Workspace is SandboxWorkspaceCopy, the default, or
+	// SandboxWorkspaceWrite. Read-only workspaces are mounted read-only.
+	Workspace string `yaml:"workspace"`
+	// CPUSeconds bounds the CPU time of every process of a command
+	CPUSeconds int `yaml:"cpu_seconds"`
+	// MemoryMB bounds the memory used by all the processes of a command
+	// together, in a cgroup created with systemd-run
+	MemoryMB int `yaml:"memory_mb"`
+	// MaxProcesses bounds the number of processes and threads of a command
+	// running at the same time, in the same cgroup
+	MaxProcesses int `yaml:"max_processes"`
+}
+
+// SandboxWorkspaceDir is where the workspace is mounted in the sandbox
+const SandboxWorkspaceDir = "/workspace"
@@ -0,0 +1,113 @@
+//go:build linux
+
+package tools
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+)
+
+// sandboxPath is the PATH of sandboxed commands, which don't inherit the
+// environment of clan
+const sandboxPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// sandboxCommand returns the command line running args in dir, within the
+// workspace root, inside the sandbox
+func sandboxCommand(options SandboxOptions, workspace Workspace, root string, dir string, env map[string]string, args []string) ([]string, error) {
+	if options.Type != "" && options.Type != SandboxBubblewrap {
+		return nil, fmt.Errorf("%w: unknown sandbox type %s", SandboxUnavailableErr, options.Type)
+	}
+
+	bwrap, err := exec.LookPath("bwrap")
+	if err != nil {
+		return nil, fmt.Errorf("%w: bubblewrap 0.8 or later is required: %w", SandboxUnavailableErr, err)
+	}
+
+	sandboxed, err := bwrapCommand(bwrap, options, workspace, root, dir, env, args)
+	if err != nil || (options.MemoryMB <= 0 && options.MaxProcesses <= 0) {
+		return sandboxed, err
+	}
+
+	systemdRun, err := exec.LookPath("systemd-run")
+	if err != nil {
+		return nil, fmt.Errorf("%w: memory_mb and max_processes require systemd-run to create a cgroup: %w", SandboxUnavailableErr, err)
+	}
+
+	return scopeCommand(systemdRun, options, os.Geteuid() != 0, sandboxed), nil
+}
+
+// scopeCommand runs args in a transient systemd scope, a cgroup whose memory
+// and number of tasks are limited for all of its processes together. Users
+// other than root use their own service manager.
+func scopeCommand(systemdRun string, options SandboxOptions, user bool, args []string) []string {
+	scoped := []string{systemdRun}
+	if user {
+		scoped = append(scoped, "--user")
+	}
+	scoped = append(scoped, "--scope", "--quiet", "--collect")
+	if options.MemoryMB > 0 {
+		scoped = append(scoped, "-p", fmt.Sprintf("MemoryMax=%dM", options.MemoryMB), "-p", "MemorySwapMax=0")
+	}
+	if options.MaxProcesses > 0 {
+		scoped = append(scoped, "-p", fmt.Sprintf("TasksMax=%d", options.MaxProcesses))
+	}
+	scoped = append(scoped, "--")
+
+	return append(scoped, args...)
+}
+
+func bwrapCommand(bwrap string, options SandboxOptions, workspace Workspace, root string, dir string, env map[string]string, args []string) ([]string, error) {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	sandboxed := []string{bwrap, "--unshare-all"}
+	if options.Network {
+		sandboxed = append(sandboxed, "--share-net")
+	}
+	sandboxed = append(sandboxed, "--die-with-parent", "--new-session",
+		"--ro-bind", "/usr", "/usr",
+		"--ro-bind-try", "/bin", "/bin",
+		"--ro-bind-try", "/sbin", "/sbin",
+		"--ro-bind-try", "/lib", "/lib",
+		"--ro-bind-try", "/lib64", "/lib64",
+		"--ro-bind-try", "/etc", "/etc",
+		"--proc", "/proc",
+		"--dev", "/dev",
+		"--tmpfs", "/tmp",
+	)
+
+	switch {
+	case workspace.ReadOnly:
+		sandboxed = append(sandboxed, "--ro-bind", root, SandboxWorkspaceDir)
+	case options.Workspace == SandboxWorkspaceWrite:
+		sandboxed = append(sandboxed, "--bind", root, SandboxWorkspaceDir)
+	default:
+		// Changes are kept in a tmpfs that is discarded with the sandbox
+		sandboxed = append(sandboxed, "--overlay-src", root, "--tmp-overlay", SandboxWorkspaceDir)
+	}
+
+	sandboxed = append(sandboxed, "--chdir", filepath.Join(SandboxWorkspaceDir, rel),
+		"--clearenv", "--setenv", "PATH", sandboxPath, "--setenv", "HOME", "/tmp")
+	keys := []string{}
+	for k := range env {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		sandboxed = append(sandboxed, "--setenv", k, env[k])
+	}
+	sandboxed = append(sandboxed, "--")
+
+	// The CPU time is a limit of every process, memory and processes are
+	// limited for the whole sandbox by scopeCommand
+	if options.CPUSeconds > 0 {
+		sandboxed = append(sandboxed, "prlimit", fmt.Sprintf("--cpu=%d", options.CPUSeconds), "--")
+	}
+
+	return append(sandboxed, args...), nil
+}
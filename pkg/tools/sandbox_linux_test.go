@@ -0,0 +1,90 @@
+//go:build linux
+
+package tools
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func requireBwrap(t *testing.T) {
+	_, err := exec.LookPath("bwrap")
+	if err != nil {
+		t.Skip("bwrap is not installed")
+	}
+}
+
+func TestBwrapCommand(t *testing.T) {
+	options := SandboxOptions{CPUSeconds: 10, MemoryMB: 512, MaxProcesses: 64}
+	args, err := bwrapCommand("bwrap", options, Workspace{}, "/home/me/project", "/home/me/project/src", map[string]string{"B": "2", "A": "1"}, []string{"make", "test"})
+	require.NoError(t, err)
+
+	line := strings.Join(args[1:], " ")
+	require.True(t, strings.HasPrefix(line, "--unshare-all --die-with-parent"), line)
+	require.Contains(t, line, "--overlay-src /home/me/project --tmp-overlay /workspace")
+	require.Contains(t, line, "--chdir /workspace/src --clearenv")
+	require.Contains(t, line, "--setenv A 1 --setenv B 2 --")
+	require.True(t, strings.HasSuffix(line, "-- prlimit --cpu=10 -- make test"), line)
+
+	args, err = bwrapCommand("bwrap", SandboxOptions{Network: true, Workspace: SandboxWorkspaceWrite}, Workspace{}, "/p", "/p", nil, []string{"ls"})
+	require.NoError(t, err)
+	line = strings.Join(args[1:], " ")
+	require.Contains(t, line, "--unshare-all --share-net")
+	require.Contains(t, line, "--bind /p /workspace")
+	require.True(t, strings.HasSuffix(line, "--setenv HOME /tmp -- ls"), line)
+
+	args, err = bwrapCommand("bwrap", SandboxOptions{Workspace: SandboxWorkspaceWrite}, Workspace{ReadOnly: true}, "/p", "/p", nil, []string{"ls"})
+	require.NoError(t, err)
+	require.Contains(t, strings.Join(args, " "), "--ro-bind /p /workspace")
+
+}
+
+func TestScopeCommand(t *testing.T) {
+	args := scopeCommand("systemd-run", SandboxOptions{MemoryMB: 512, MaxProcesses: 64}, true, []string{"bwrap", "--", "make"})
+	require.Equal(t, "systemd-run --user --scope --quiet --collect -p MemoryMax=512M -p MemorySwapMax=0 -p TasksMax=64 -- bwrap -- make", strings.Join(args, " "))
+
+	args = scopeCommand("systemd-run", SandboxOptions{MaxProcesses: 8}, false, []string{"bwrap"})
+	require.Equal(t, "systemd-run --scope --quiet --collect -p TasksMax=8 -- bwrap", strings.Join(args, " "))
+}
+
+func TestSandboxCommandChecksType(t *testing.T) {
+	_, err := sandboxCommand(SandboxOptions{Type: "docker"}, Workspace{}, "/p", "/p", nil, []string{"ls"})
+	require.ErrorIs(t, err, SandboxUnavailableErr)
+	require.ErrorContains(t, err, "unknown sandbox type docker")
+}
+
+func TestRunnerInSandbox(t *testing.T) {
+	requireBwrap(t)
+	ws, outside := newTestWorkspace(t)
+	r := NewRunner(ws, CommandOptions{Shell: true, Sandbox: &SandboxOptions{}})
+
+	result, err := r.Execute(context.Background(), map[string]interface{}{"command": "pwd; cat src/main.py; echo changed > src/main.py"})
+	if err != nil && strings.Contains(err.Error(), "overlay") {
+		t.Skipf("bwrap cannot create overlays here: %s", err)
+	}
+	require.NoError(t, err)
+	require.Equal(t, "exit code: 0\nstdout:\n/workspace\nprint(1)\n", result)
+	// The change was made to a throwaway copy
+	require.Equal(t, "print(1)", readWorkspaceFile(t, ws, "src/main.py"))
+
+	result, err = r.Execute(context.Background(), map[string]interface{}{"command": "cat " + filepath.Join(outside, "secret")})
+	require.NoError(t, err)
+	require.Contains(t, result, "exit code: 1")
+	require.NotContains(t, result, "stdout:")
+}
+
+func TestRunnerWithoutBwrap(t *testing.T) {
+	_, err := exec.LookPath("bwrap")
+	if err == nil {
+		t.Skip("bwrap is installed")
+	}
+	ws, _ := newTestWorkspace(t)
+
+	_, err = NewRunner(ws, CommandOptions{Sandbox: &SandboxOptions{}}).Execute(context.Background(), map[string]interface{}{"command": "ls"})
+	require.ErrorIs(t, err, SandboxUnavailableErr)
+}
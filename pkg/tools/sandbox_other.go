@@ -0,0 +1,9 @@
+//go:build !linux
+
+package tools
+
+import "fmt"
+
+func sandboxCommand(options SandboxOptions, workspace Workspace, root string, dir string, env map[string]string, args []string) ([]string, error) {
+	return nil, fmt.Errorf("%w: sandboxes are only supported on Linux", SandboxUnavailableErr)
+}
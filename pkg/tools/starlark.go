@@ -3,9 +3,10 @@ package tools
 import (
 	"bytes"
 	"clan/pkg/llm"
+	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
@@ -24,6 +25,30 @@ func NewStarlarkHandler(def *StarlarkTool) Tool {
 	}
 }
 
+// starlarkBuiltins are the names predeclared for the functions of Starlark
+// tools in addition to the Starlark universe
+var starlarkBuiltins = map[string]bool{"get": true, "post": true, "getEnv": true}
+
+// Compile checks the syntax of the tool's function and that it defines a
+// function named after the tool in lower case, without running it
+func (def *StarlarkTool) Compile() error {
+	f, _, err := starlark.SourceProgramOptions(&syntax.FileOptions{}, "sf.star", def.Function, func(name string) bool {
+		return starlarkBuiltins[name]
+	})
+	if err != nil {
+		return err
+	}
+
+	fnName := strings.ToLower(def.Name)
+	for _, stmt := range f.Stmts {
+		if d, ok := stmt.(*syntax.DefStmt); ok && d.Name.Name == fnName {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("expected function %s not found", fnName)
+}
+
 func (r *starlarkHandler) Name() string {
 	return r.definition.Name
 }
@@ -48,14 +73,25 @@ func (r *starlarkHandler) Schema() llm.Tool {
 	}
 }
 
-func (r *starlarkHandler) Execute(params map[string]interface{}) (string, error) {
+func (r *starlarkHandler) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
 	sf := r.definition.Function
 	thread := &starlark.Thread{Name: "function thread"}
 
+	// Interrupt the Starlark program when ctx is cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel(ctx.Err().Error())
+		case <-done:
+		}
+	}()
+
 	predeclared := starlark.StringDict{
 		"get": starlark.NewBuiltin("get", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
-			log.Printf("Called function with args %s", args)
-			req, err := http.NewRequest(http.MethodGet, args[0].(starlark.String).GoString(), nil)
+			slog.Debug("Starlark builtin called", "builtin", fn.Name(), "args", args.String())
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, args[0].(starlark.String).GoString(), nil)
 			if err != nil {
 				return starlark.String(err.Error()), err
 			}
@@ -77,14 +113,14 @@ func (r *starlarkHandler) Execute(params map[string]interface{}) (string, error)
 		}),
 
 		"post": starlark.NewBuiltin("post", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
-			log.Printf("Called function with args %s", args)
+			slog.Debug("Starlark builtin called", "builtin", fn.Name(), "args", args.String())
 			url := args[0].(starlark.String).GoString()
 			headers := args[1].(*starlark.Dict)
 			body := args[2].(starlark.String).GoString()
-			log.Printf("body is %s and url is %s", body, url)
+			slog.Debug("Starlark post", "url", url, "body", body)
 
 			buf := bytes.NewBufferString(body)
-			req, err := http.NewRequest(http.MethodPost, url, buf)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, buf)
 			if err != nil {
 				return starlark.String(err.Error()), err
 			}
@@ -119,7 +155,7 @@ func (r *starlarkHandler) Execute(params map[string]interface{}) (string, error)
 
 	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, "sf.star", sf, predeclared)
 	if err != nil {
-		log.Printf("Unable to execute the Starlark function. Err is %s", err)
+		slog.Debug("Unable to execute the Starlark function", "tool", r.definition.Name, "err", err)
 		return "", err
 	}
 
@@ -127,7 +163,7 @@ func (r *starlarkHandler) Execute(params map[string]interface{}) (string, error)
 
 	for _, p := range r.definition.Parameters {
 		pv, exists := params[p.Name]
-		if !exists {
+		if !exists || pv == nil {
 			sfState = append(sfState, starlark.NoneType(' '))
 			continue
 		}
@@ -135,11 +171,26 @@ func (r *starlarkHandler) Execute(params map[string]interface{}) (string, error)
 
 		switch p.Type {
 		case "string":
-			starlarkParam = starlark.String(pv.(string))
+			s, err := stringParam(params, p.Name)
+			if err != nil {
+				return "", err
+			}
+			starlarkParam = starlark.String(s)
 		case "integer":
-			starlarkParam = starlark.MakeInt(pv.(int))
+			n, err := numberParam(params, p.Name)
+			if err != nil {
+				return "", err
+			}
+			if n != float64(int64(n)) {
+				return "", fmt.Errorf("parameter %s must be an integer", p.Name)
+			}
+			starlarkParam = starlark.MakeInt64(int64(n))
 		case "boolean":
-			starlarkParam = starlark.Bool(pv.(bool))
+			b, err := boolParam(params, p.Name)
+			if err != nil {
+				return "", err
+			}
+			starlarkParam = starlark.Bool(b)
 		}
 
 		sfState = append(sfState, starlarkParam)
@@ -154,11 +205,14 @@ func (r *starlarkHandler) Execute(params map[string]interface{}) (string, error)
 
 	res, err := starlark.Call(thread, fn, sfState, nil)
 	if err != nil {
-		log.Printf("Error executing the Starlark function %s", err)
+		slog.Debug("Error executing the Starlark function", "tool", r.definition.Name, "err", err)
 		return "", err
 	}
 
-	log.Printf("RESPONSE FROM STARLARK FUNCTION CALL IS %s", res)
+	slog.Debug("Starlark function returned", "tool", r.definition.Name, "result", res.String())
 
-	return res.(starlark.String).GoString(), nil
+	if s, ok := res.(starlark.String); ok {
+		return s.GoString(), nil
+	}
+	return res.String(), nil
 }
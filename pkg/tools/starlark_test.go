@@ -1,7 +1,9 @@
 package tools
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -65,7 +67,7 @@ func TestExecute(t *testing.T) {
 	}
 
 	tool := NewStarlarkHandler(&std)
-	output, err := tool.Execute(map[string]interface{}{
+	output, err := tool.Execute(context.Background(), map[string]interface{}{
 		"name":     "Dodgy",
 		"location": "London",
 	})
@@ -74,6 +76,33 @@ func TestExecute(t *testing.T) {
 	assert.Equal(t, output, "Hello DodgyLondon")
 }
 
+func TestExecuteChecksParameterTypes(t *testing.T) {
+	std := StarlarkTool{
+		Name: "Repeat",
+		Parameters: []StarlarkToolParameter{
+			{Name: "word", Type: "string"},
+			{Name: "times", Type: "integer"},
+			{Name: "loud", Type: "boolean"},
+		},
+		Function: `def repeat(word, times, loud):
+			return (word.upper() if loud else word) * times`,
+	}
+
+	tool := NewStarlarkHandler(&std)
+
+	// Numbers decoded from JSON are float64
+	output, err := tool.Execute(context.Background(), map[string]interface{}{"word": "ab", "times": float64(2), "loud": true})
+	assert.NoError(t, err)
+	assert.Equal(t, "ABAB", output)
+
+	_, err = tool.Execute(context.Background(), map[string]interface{}{"word": "ab", "times": 1.5, "loud": true})
+	assert.EqualError(t, err, "parameter times must be an integer")
+	_, err = tool.Execute(context.Background(), map[string]interface{}{"word": 1, "times": 2, "loud": true})
+	assert.EqualError(t, err, "parameter word must be a string")
+	_, err = tool.Execute(context.Background(), map[string]interface{}{"word": "ab", "times": 2, "loud": "yes"})
+	assert.EqualError(t, err, "parameter loud must be a boolean")
+}
+
 func TestExecuteErrorWhenFunctionNameIncorrect(t *testing.T) {
 	std := StarlarkTool{
 		Name:        "Hello",
@@ -95,7 +124,7 @@ func TestExecuteErrorWhenFunctionNameIncorrect(t *testing.T) {
 	}
 
 	tool := NewStarlarkHandler(&std)
-	_, err := tool.Execute(map[string]interface{}{
+	_, err := tool.Execute(context.Background(), map[string]interface{}{
 		"name":     "Dodgy",
 		"location": "London",
 	})
@@ -121,7 +150,7 @@ func TestExecuteWithHTTPGet(t *testing.T) {
 	}
 
 	tool := NewStarlarkHandler(&std)
-	output, err := tool.Execute(map[string]interface{}{
+	output, err := tool.Execute(context.Background(), map[string]interface{}{
 		"term": "Dodgy",
 	})
 
@@ -140,7 +169,7 @@ func TestExecuteWithGetEnv(t *testing.T) {
 	}
 
 	tool := NewStarlarkHandler(&std)
-	output, err := tool.Execute(map[string]interface{}{})
+	output, err := tool.Execute(context.Background(), map[string]interface{}{})
 
 	assert.NoError(t, err)
 	assert.Equal(t, "1", output)
@@ -166,10 +195,42 @@ func TestExecuteWithHTTPPost(t *testing.T) {
 	}
 
 	tool := NewStarlarkHandler(&std)
-	output, err := tool.Execute(map[string]interface{}{
+	output, err := tool.Execute(context.Background(), map[string]interface{}{
 		"term": "Dodgy",
 	})
 
 	assert.NoError(t, err)
 	assert.NotEqual(t, output, "")
 }
+
+func TestExecuteCancelled(t *testing.T) {
+	std := StarlarkTool{
+		Name:        "Spin",
+		Description: "A Starlark tool that does not finish",
+		Function: `def spin():
+			for i in range(1000000000):
+				pass
+			return "done"`,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	tool := NewStarlarkHandler(&std)
+	_, err := tool.Execute(ctx, map[string]interface{}{})
+	assert.ErrorContains(t, err, "context deadline exceeded")
+}
+
+func TestCompile(t *testing.T) {
+	std := StarlarkTool{
+		Name:     "Search",
+		Function: "def search(query):\n  return get(\"https://example.com/?q=\" + query)\n",
+	}
+	assert.NoError(t, std.Compile())
+
+	std.Name = "Lookup"
+	assert.ErrorContains(t, std.Compile(), "expected function lookup not found")
+
+	std.Function = "def lookup():\n  return undefined_name\n"
+	assert.ErrorContains(t, std.Compile(), "undefined: undefined_name")
+}
@@ -3,12 +3,14 @@ package tools
 import (
 	"clan/pkg/llm"
 	"clan/pkg/planning"
+	"context"
+	"fmt"
 )
 
 type Tool interface {
 	Name() string
 	Schema() llm.Tool
-	Execute(map[string]interface{}) (string, error)
+	Execute(ctx context.Context, params map[string]interface{}) (string, error)
 }
 
 type StarlarkTool struct {
@@ -26,11 +28,72 @@ type StarlarkToolParameter struct {
 
 // var AllTools = []Tool{NewReader(), NewWriter(), NewRunner(), NewNextAgentSelector(), planning.NewCreatePlan(), planning.NewUpdatePlan(), planning.NewGetPlan()}
 
-func AllTools(starlarkToolDefs []StarlarkTool) []Tool {
-	baseTools := []Tool{NewReader(), NewWriter(), NewRunner(), NewNextAgentSelector(), planning.NewCreatePlan(), planning.NewUpdatePlan(), planning.NewGetPlan()}
+// AllTools returns the builtin tools operating in workspace, with commands
+// configuring CommandRunner, followed by the Starlark tools
+func AllTools(workspace Workspace, commands CommandOptions, starlarkToolDefs []StarlarkTool) []Tool {
+	baseTools := []Tool{
+		NewReader(workspace), NewWriter(workspace), NewEditor(workspace), NewPatcher(workspace), NewDeleter(workspace), NewMover(workspace),
+		NewRunner(workspace, commands), NewNextAgentSelector(), NewAskHuman(), planning.NewCreatePlan(), planning.NewUpdatePlan(), planning.NewGetPlan(),
+	}
 	for _, def := range starlarkToolDefs {
 		baseTools = append(baseTools, NewStarlarkHandler(&def))
 	}
 
 	return baseTools
 }
+
+// stringParam returns the string parameter name, which models may omit
+func stringParam(params map[string]interface{}, name string) (string, error) {
+	value, exists := params[name]
+	if !exists {
+		return "", fmt.Errorf("missing parameter %s", name)
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("parameter %s must be a string", name)
+	}
+
+	return s, nil
+}
+
+// optionalStringParam returns the optional string parameter name, empty when
+// omitted
+func optionalStringParam(params map[string]interface{}, name string) (string, error) {
+	value, exists := params[name]
+	if !exists || value == nil {
+		return "", nil
+	}
+	return stringParam(params, name)
+}
+
+// numberParam returns the optional number parameter name, zero when omitted
+func numberParam(params map[string]interface{}, name string) (float64, error) {
+	value, exists := params[name]
+	if !exists || value == nil {
+		return 0, nil
+	}
+
+	switch n := value.(type) {
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	}
+	return 0, fmt.Errorf("parameter %s must be a number", name)
+}
+
+// boolParam returns the optional boolean parameter name, false when omitted
+func boolParam(params map[string]interface{}, name string) (bool, error) {
+	value, exists := params[name]
+	if !exists || value == nil {
+		return false, nil
+	}
+
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("parameter %s must be a boolean", name)
+	}
+
+	return b, nil
+}
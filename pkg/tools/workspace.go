@@ -0,0 +1,131 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	OutsideWorkspaceErr  = errors.New("path is outside the workspace")
+	ReadOnlyWorkspaceErr = errors.New("workspace is read-only")
+)
+
+// DefaultWorkspace is the directory the file and command tools operate in
+// when no workspace is configured
+const DefaultWorkspace = "./workspace"
+
+// Workspace is the directory the file and command tools are confined to.
+// Tools given a read-only workspace can read files but not change them.
+type Workspace struct {
+	Root     string
+	ReadOnly bool
+}
+
+func (w Workspace) root() string {
+	if w.Root == "" {
+		return DefaultWorkspace
+	}
+	return w.Root
+}
+
+// Resolve returns the location of p, relative to the workspace root or
+// absolute, after following symbolic links. An OutsideWorkspaceErr is
+// returned when it is not within the workspace. Paths that do not exist yet
+// are resolved through their closest existing parent.
+func (w Workspace) Resolve(p string) (string, error) {
+	root, err := resolveSymlinks(w.root())
+	if err != nil {
+		return "", err
+	}
+
+	target := p
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(w.root(), target)
+	}
+	target, err = resolveSymlinks(target)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s is not within %s", OutsideWorkspaceErr, p, root)
+	}
+
+	return target, nil
+}
+
+// ResolveWritable resolves p like Resolve for tools that change files
+func (w Workspace) ResolveWritable(p string) (string, error) {
+	if w.ReadOnly {
+		return "", fmt.Errorf("%w: unable to change %s", ReadOnlyWorkspaceErr, p)
+	}
+	return w.Resolve(p)
+}
+
+// ResolveEntry resolves p like ResolveWritable but leaves its last element
+// as is, so that tools deleting or moving a link change the link rather than
+// what it points to
+func (w Workspace) ResolveEntry(p string) (string, error) {
+	clean := filepath.Clean(p)
+	base := filepath.Base(clean)
+	if base == "." || base == ".." || base == string(filepath.Separator) {
+		return w.ResolveWritable(clean)
+	}
+
+	parent, err := w.ResolveWritable(filepath.Dir(clean))
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(parent, base), nil
+}
+
+// maxSymlinks bounds the number of dangling links followed by resolveSymlinks
+const maxSymlinks = 40
+
+// resolveSymlinks returns the absolute form of p with the symbolic links of
+// its longest existing prefix evaluated. Dangling links are followed too, so
+// that creating a file through one cannot write outside the workspace.
+func resolveSymlinks(p string) (string, error) {
+	p, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+
+	missing := []string{}
+	links := 0
+	for {
+		resolved, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+
+		target, linkErr := os.Readlink(p)
+		if linkErr == nil {
+			links++
+			if links > maxSymlinks {
+				return "", fmt.Errorf("too many symbolic links in %s", p)
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(p), target)
+			}
+			p = filepath.Join(append([]string{target}, missing...)...)
+			missing = []string{}
+			continue
+		}
+
+		parent := filepath.Dir(p)
+		if parent == p {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(p)}, missing...)
+		p = parent
+	}
+}
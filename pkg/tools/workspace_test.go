@@ -0,0 +1,105 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestWorkspace(t *testing.T) (Workspace, string) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "workspace")
+	outside := filepath.Join(dir, "outside")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "src"), 0755))
+	require.NoError(t, os.MkdirAll(outside, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "src", "main.py"), []byte("print(1)"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0644))
+
+	return Workspace{Root: root}, outside
+}
+
+func TestWorkspaceResolve(t *testing.T) {
+	ws, outside := newTestWorkspace(t)
+	root, err := filepath.EvalSymlinks(ws.Root)
+	require.NoError(t, err)
+
+	resolved, err := ws.Resolve("src/main.py")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, "src", "main.py"), resolved)
+
+	// Paths that do not exist yet resolve through their parents
+	resolved, err = ws.Resolve("new/dir/file.txt")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, "new", "dir", "file.txt"), resolved)
+
+	resolved, err = ws.Resolve(filepath.Join(ws.Root, "src"))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, "src"), resolved)
+
+	for _, p := range []string{"../outside/secret", "src/../../outside/secret", filepath.Join(outside, "secret"), "/etc/passwd", ".."} {
+		_, err = ws.Resolve(p)
+		require.ErrorIs(t, err, OutsideWorkspaceErr, p)
+	}
+}
+
+func TestWorkspaceResolveSymlinks(t *testing.T) {
+	ws, outside := newTestWorkspace(t)
+
+	require.NoError(t, os.Symlink(outside, filepath.Join(ws.Root, "escape")))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "missing"), filepath.Join(ws.Root, "dangling")))
+	require.NoError(t, os.Symlink("src", filepath.Join(ws.Root, "source")))
+
+	for _, p := range []string{"escape/secret", "escape/new.txt", "dangling", "dangling/new.txt"} {
+		_, err := ws.Resolve(p)
+		require.ErrorIs(t, err, OutsideWorkspaceErr, p)
+	}
+
+	// Links that stay within the workspace are allowed
+	resolved, err := ws.Resolve("source/main.py")
+	require.NoError(t, err)
+	require.Equal(t, "main.py", filepath.Base(resolved))
+	require.Equal(t, "src", filepath.Base(filepath.Dir(resolved)))
+}
+
+func TestWorkspaceMissingRoot(t *testing.T) {
+	ws := Workspace{Root: filepath.Join(t.TempDir(), "missing")}
+
+	_, err := ws.Resolve("file.txt")
+	require.NoError(t, err)
+	_, err = ws.Resolve("../file.txt")
+	require.ErrorIs(t, err, OutsideWorkspaceErr)
+}
+
+func TestReaderAndWriterStayInTheWorkspace(t *testing.T) {
+	ws, outside := newTestWorkspace(t)
+
+	content, err := NewReader(ws).Execute(context.Background(), map[string]interface{}{"filepath": "src/main.py"})
+	require.NoError(t, err)
+	require.Equal(t, "print(1)", content)
+
+	_, err = NewReader(ws).Execute(context.Background(), map[string]interface{}{"filepath": "../outside/secret"})
+	require.ErrorIs(t, err, OutsideWorkspaceErr)
+	require.ErrorContains(t, err, "../outside/secret is not within")
+
+	_, err = NewWriter(ws).Execute(context.Background(), map[string]interface{}{"filepath": "../outside/secret", "content": "changed"})
+	require.ErrorIs(t, err, OutsideWorkspaceErr)
+	secret, err := os.ReadFile(filepath.Join(outside, "secret"))
+	require.NoError(t, err)
+	require.Equal(t, "secret", string(secret))
+}
+
+func TestWriterWithReadOnlyWorkspace(t *testing.T) {
+	ws, _ := newTestWorkspace(t)
+	ws.ReadOnly = true
+
+	_, err := NewWriter(ws).Execute(context.Background(), map[string]interface{}{"filepath": "src/main.py", "content": "print(2)"})
+	require.ErrorIs(t, err, ReadOnlyWorkspaceErr)
+
+	// Reading is still allowed
+	content, err := NewReader(ws).Execute(context.Background(), map[string]interface{}{"filepath": "src/main.py"})
+	require.NoError(t, err)
+	require.Equal(t, "print(1)", content)
+}
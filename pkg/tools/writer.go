@@ -2,14 +2,23 @@ package tools
 
 import (
 	"clan/pkg/llm"
+	"context"
+	"fmt"
 	"os"
-	"path"
+	"path/filepath"
 )
 
-type writer struct{}
+const (
+	WriteOverwrite = "overwrite"
+	WriteAppend    = "append"
+)
+
+type writer struct {
+	workspace Workspace
+}
 
-func NewWriter() Tool {
-	return &writer{}
+func NewWriter(workspace Workspace) Tool {
+	return &writer{workspace: workspace}
 }
 
 func (w *writer) Name() string {
@@ -19,32 +28,80 @@ func (w *writer) Name() string {
 func (w *writer) Schema() llm.Tool {
 	return llm.Tool{
 		Name:        w.Name(),
-		Description: "Write files in the filesystem including modifying existing files",
+		Description: "Write files in the filesystem including modifying existing files. Missing parent directories are created.",
 		Schema: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
 				"filepath": map[string]interface{}{
 					"type":        "string",
-					"description": "Location of the file in the filesystem",
+					"description": "Location of the file, relative to the workspace",
 				},
 				"content": map[string]interface{}{
 					"type":        "string",
 					"description": "Content to write into the file",
 				},
+				"mode": map[string]interface{}{
+					"type":        "string",
+					"enum":        []string{WriteOverwrite, WriteAppend},
+					"description": "overwrite replaces the file, the default, append adds the content to its end",
+				},
 			},
+			"required": []string{"filepath", "content"},
 		},
 	}
 }
 
-func (r *writer) Execute(params map[string]interface{}) (string, error) {
-	fp := params["filepath"].(string)
-	fp = path.Join("./workspace", fp)
-	fileContent := params["content"].(string)
+func (r *writer) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	fp, err := stringParam(params, "filepath")
+	if err != nil {
+		return "", err
+	}
+	fileContent, err := stringParam(params, "content")
+	if err != nil {
+		return "", err
+	}
+	mode := WriteOverwrite
+	if _, exists := params["mode"]; exists {
+		mode, err = stringParam(params, "mode")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	flag := os.O_WRONLY | os.O_CREATE
+	switch mode {
+	case WriteOverwrite:
+		flag |= os.O_TRUNC
+	case WriteAppend:
+		flag |= os.O_APPEND
+	default:
+		return "", fmt.Errorf("unknown mode %s, expected %s or %s", mode, WriteOverwrite, WriteAppend)
+	}
 
-	err := os.WriteFile(fp, []byte(fileContent), os.ModePerm)
+	fp, err = r.workspace.ResolveWritable(fp)
 	if err != nil {
 		return "", err
 	}
 
+	err = os.MkdirAll(filepath.Dir(fp), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.OpenFile(fp, flag, 0644)
+	if err != nil {
+		return "", err
+	}
+	_, err = f.WriteString(fileContent)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if mode == WriteAppend {
+		return "Content appended successfully", nil
+	}
 	return "File written successfully", nil
 }
@@ -0,0 +1,51 @@
+package workflow
+
+import (
+	"clan/pkg/tools"
+	"context"
+	"time"
+)
+
+// CommandApproval records the decision taken by a person on a command an
+// agent wanted to run
+type CommandApproval struct {
+	Agent   string `json:"agent"`
+	Command string `json:"command"`
+	// EditedCommand is the command that ran instead when it was changed
+	EditedCommand string    `json:"edited_command,omitempty"`
+	Approved      bool      `json:"approved"`
+	Reason        string    `json:"reason,omitempty"`
+	Time          time.Time `json:"time"`
+}
+
+// approver sends an ApprovalRequested event for every command of agentName
+// that needs approval and records the answer in the state
+func (ws *WorkflowState) approver(agentName string, events chan Event) tools.Approver {
+	return func(ctx context.Context, command string) (tools.Approval, error) {
+		defer waitForPerson(ctx)()
+
+		reply := make(chan tools.Approval, 1)
+		events <- ApprovalRequested{Agent: agentName, Tool: "CommandRunner", Command: command, reply: reply}
+
+		var approval tools.Approval
+		select {
+		case approval = <-reply:
+		case <-ctx.Done():
+			return tools.Approval{}, ctx.Err()
+		}
+
+		record := CommandApproval{
+			Agent:    agentName,
+			Command:  command,
+			Approved: approval.Approved,
+			Reason:   approval.Reason,
+			Time:     time.Now().UTC(),
+		}
+		if approval.Approved && approval.Command != "" && approval.Command != command {
+			record.EditedCommand = approval.Command
+		}
+		ws.Approvals = append(ws.Approvals, record)
+
+		return approval, nil
+	}
+}
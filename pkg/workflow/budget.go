@@ -0,0 +1,184 @@
+package workflow
+
+import (
+	"clan/pkg/clan"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var BudgetExceededErr = errors.New("budget exceeded")
+
+// BudgetDefinition limits the resources a workflow or an agent may consume.
+// Zero values are unlimited.
+type BudgetDefinition struct {
+	MaxTokens    int           `yaml:"max_tokens"`
+	MaxCost      float64       `yaml:"max_cost"`
+	MaxDuration  time.Duration `yaml:"max_duration"`
+	MaxToolCalls int           `yaml:"max_tool_calls"`
+}
+
+// BudgetExceededError reports which limit stopped a run. Durations are
+// expressed in seconds and costs in US dollars.
+type BudgetExceededError struct {
+	// AgentName is empty when the workflow budget was exceeded
+	AgentName string
+	Limit     string
+	Max       float64
+	Used      float64
+}
+
+func (e *BudgetExceededError) Error() string {
+	scope := "workflow"
+	if e.AgentName != "" {
+		scope = fmt.Sprintf("agent %s", e.AgentName)
+	}
+
+	return fmt.Sprintf("%s %s: %s is %g but %g would be used", scope, BudgetExceededErr, e.Limit, e.Max, e.Used)
+}
+
+func (e *BudgetExceededError) Unwrap() error {
+	return BudgetExceededErr
+}
+
+// check returns a *BudgetExceededError when usage has reached the budget or
+// when making pendingToolCalls more tool calls would exceed it
+func (b *BudgetDefinition) check(agentName string, usage UsageSummary, pendingToolCalls int) error {
+	if b == nil {
+		return nil
+	}
+
+	exceeded := func(limit string, max float64, used float64) error {
+		return &BudgetExceededError{AgentName: agentName, Limit: limit, Max: max, Used: used}
+	}
+
+	switch {
+	case b.MaxTokens > 0 && usage.Total() >= b.MaxTokens:
+		return exceeded("max_tokens", float64(b.MaxTokens), float64(usage.Total()))
+	case b.MaxCost > 0 && usage.Cost >= b.MaxCost:
+		return exceeded("max_cost", b.MaxCost, usage.Cost)
+	case b.MaxDuration > 0 && usage.Duration >= b.MaxDuration:
+		return exceeded("max_duration", b.MaxDuration.Seconds(), usage.Duration.Seconds())
+	case b.MaxToolCalls > 0 && usage.ToolCalls+pendingToolCalls > b.MaxToolCalls:
+		return exceeded("max_tool_calls", float64(b.MaxToolCalls), float64(usage.ToolCalls+pendingToolCalls))
+	}
+
+	return nil
+}
+
+// nodeClock measures the time a node runs, leaving out the time it waits
+// for a person to answer a question or approve a command. With a timer, the
+// timer is stopped during the waits and fires once remaining has run.
+type nodeClock struct {
+	mu        sync.Mutex
+	start     time.Time
+	waited    time.Duration
+	waitStart time.Time
+
+	timer     *time.Timer
+	remaining time.Duration
+}
+
+type nodeClockKey struct{}
+
+func (c *nodeClock) elapsed() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.elapsedLocked()
+}
+
+func (c *nodeClock) elapsedLocked() time.Duration {
+	waited := c.waited
+	if !c.waitStart.IsZero() {
+		waited += time.Since(c.waitStart)
+	}
+	return time.Since(c.start) - waited
+}
+
+// waitForPerson stops the clock of the node running with ctx until the
+// returned function is called
+func waitForPerson(ctx context.Context) func() {
+	c, ok := ctx.Value(nodeClockKey{}).(*nodeClock)
+	if !ok {
+		return func() {}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.waitStart = time.Now()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.waited += time.Since(c.waitStart)
+		c.waitStart = time.Time{}
+		if c.timer != nil {
+			c.timer.Reset(c.remaining - c.elapsedLocked())
+		}
+	}
+}
+
+// withDurationBudget runs node, adding the time it ran to the usage of
+// agent, with a deadline at the end of the time left in the max_duration
+// budgets of agent and of the workflow, so that a model call or a tool that
+// hangs is stopped. Waits for a person are not counted. Reaching the
+// deadline fails the node with a *BudgetExceededError unless it completed.
+func withDurationBudget(definition *WorkflowDefinition, agent *AgentDefinition, node clan.NodeFunc[WorkflowState]) clan.NodeFunc[WorkflowState] {
+	return func(ctx context.Context, ws *WorkflowState) (*WorkflowState, error) {
+		var exceeded *BudgetExceededError
+		var remaining time.Duration
+		limit := func(b *BudgetDefinition, agentName string, used UsageSummary) {
+			if b == nil || b.MaxDuration <= 0 {
+				return
+			}
+			left := b.MaxDuration - used.Duration
+			if exceeded == nil || left < remaining {
+				exceeded = &BudgetExceededError{AgentName: agentName, Limit: "max_duration", Max: b.MaxDuration.Seconds()}
+				remaining = left
+			}
+		}
+		limit(agent.Budget, agent.Name, ws.AgentUsage[agent.Name])
+		limit(definition.Budget, "", ws.TotalUsage)
+
+		clock := &nodeClock{start: time.Now(), remaining: remaining}
+		ctx = context.WithValue(ctx, nodeClockKey{}, clock)
+		if exceeded != nil {
+			var cancel context.CancelCauseFunc
+			ctx, cancel = context.WithCancelCause(ctx)
+			defer cancel(nil)
+			clock.timer = time.AfterFunc(remaining, func() { cancel(exceeded) })
+			defer clock.timer.Stop()
+		}
+
+		next, err := node(ctx, ws)
+		ws.addDuration(agent.Name, clock.elapsed())
+
+		// A node that completed as the deadline was reached keeps its result,
+		// the budget check of the next node stops the run
+		if err == nil || exceeded == nil || !errors.Is(context.Cause(ctx), exceeded) {
+			return next, err
+		}
+
+		used := ws.TotalUsage.Duration
+		if exceeded.AgentName != "" {
+			used = ws.AgentUsage[agent.Name].Duration
+		}
+		exceeded.Used = used.Seconds()
+		return nil, exceeded
+	}
+}
+
+// checkBudgets checks the agent's budget and then the workflow's budget
+func (ws *WorkflowState) checkBudgets(definition *WorkflowDefinition, agent *AgentDefinition, pendingToolCalls int) error {
+	err := agent.Budget.check(agent.Name, ws.AgentUsage[agent.Name], pendingToolCalls)
+	if err != nil {
+		return err
+	}
+
+	return definition.Budget.check("", ws.TotalUsage, pendingToolCalls)
+}
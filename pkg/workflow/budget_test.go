@@ -0,0 +1,54 @@
+package workflow
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDurationBudgetKeepsCompletedNodes(t *testing.T) {
+	agent := &AgentDefinition{Name: "Worker", Budget: &BudgetDefinition{MaxDuration: 50 * time.Millisecond}}
+	node := withDurationBudget(&WorkflowDefinition{}, agent, func(ctx context.Context, ws *WorkflowState) (*WorkflowState, error) {
+		<-ctx.Done()
+		return ws, nil
+	})
+
+	next, err := node(context.Background(), &WorkflowState{})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, next.AgentUsage["Worker"].Duration, 50*time.Millisecond)
+
+	// The next node is stopped by its budget check
+	require.ErrorIs(t, next.checkBudgets(&WorkflowDefinition{}, agent, 0), BudgetExceededErr)
+}
+
+func TestDurationBudgetDoesNotCountWaits(t *testing.T) {
+	agent := &AgentDefinition{Name: "Worker"}
+	definition := &WorkflowDefinition{Budget: &BudgetDefinition{MaxDuration: 100 * time.Millisecond}}
+	node := withDurationBudget(definition, agent, func(ctx context.Context, ws *WorkflowState) (*WorkflowState, error) {
+		done := waitForPerson(ctx)
+		time.Sleep(300 * time.Millisecond)
+		done()
+		return ws, ctx.Err()
+	})
+
+	next, err := node(context.Background(), &WorkflowState{})
+	require.NoError(t, err)
+	require.Less(t, next.TotalUsage.Duration, 100*time.Millisecond)
+
+	// The deadline is still enforced after the wait
+	node = withDurationBudget(definition, agent, func(ctx context.Context, ws *WorkflowState) (*WorkflowState, error) {
+		done := waitForPerson(ctx)
+		time.Sleep(150 * time.Millisecond)
+		done()
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	_, err = node(context.Background(), &WorkflowState{})
+	var exceeded *BudgetExceededError
+	require.ErrorAs(t, err, &exceeded)
+	require.Equal(t, "", exceeded.AgentName)
+	require.GreaterOrEqual(t, exceeded.Used, 0.1)
+}
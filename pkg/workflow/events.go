@@ -0,0 +1,166 @@
+package workflow
+
+import (
+	"clan/pkg/llm"
+	"clan/pkg/planning"
+	"clan/pkg/tools"
+	"strings"
+)
+
+// Event is sent on the channel returned by Run.Events
+type Event interface {
+	isEvent()
+}
+
+// NodeStarted is sent when a node starts working, after its budgets have
+// been checked. Agent is the agent the node belongs to.
+type NodeStarted struct {
+	Node  string
+	Agent string
+}
+
+// ModelDelta is sent for every increment of an agent's response while the
+// model is generating it
+type ModelDelta struct {
+	AgentName string
+	Delta     llm.Delta
+}
+
+// ModelResponded is sent once an agent's response is complete
+type ModelResponded struct {
+	Agent    string
+	Messages []llm.Message
+	Usage    llm.Usage
+	Cost     float64
+	// Streamed is true when the response was also sent as ModelDelta events
+	Streamed bool
+}
+
+// Text returns the text blocks of the response
+func (e ModelResponded) Text() string {
+	texts := []string{}
+	for _, m := range e.Messages {
+		for _, c := range m.Content {
+			if c.ContentType == "text" {
+				texts = append(texts, c.Text)
+			}
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// ToolCalled is sent before a tool requested by an agent is executed
+type ToolCalled struct {
+	Agent     string
+	Tool      string
+	ToolUseID string
+	Input     map[string]interface{}
+}
+
+// ToolReturned is sent with the result given to the agent for a tool call.
+// IsError is true when the tool failed or does not exist.
+type ToolReturned struct {
+	Agent     string
+	Tool      string
+	ToolUseID string
+	Result    string
+	IsError   bool
+}
+
+// ApprovalRequested is sent before a command that needs approval runs. The
+// run waits until Respond is called with the decision.
+type ApprovalRequested struct {
+	Agent   string
+	Tool    string
+	Command string
+
+	reply chan tools.Approval
+}
+
+// Respond answers the request. Only the first answer is used.
+func (e ApprovalRequested) Respond(approval tools.Approval) {
+	select {
+	case e.reply <- approval:
+	default:
+	}
+}
+
+// InputRequested is sent when a person needs to answer a question, asked
+// by an agent with AskHuman or handed over to Human, a human agent. The run
+// waits until Answer or Postpone is called.
+type InputRequested struct {
+	// Agent is the agent asking the question
+	Agent string
+	// Human is the human agent expected to reply, empty for AskHuman
+	Human string
+	// ToolUseID is the AskHuman call asking the question
+	ToolUseID string
+	Question  string
+	// Pending is true for the question a resumed run stopped waiting for
+	Pending bool
+	// Summaries are those of the agents that have completed their work
+	Summaries []Summary
+
+	reply chan inputReply
+}
+
+// Answer replies to the question. Only the first reply is used.
+func (e InputRequested) Answer(answer string) {
+	select {
+	case e.reply <- inputReply{answer: answer}:
+	default:
+	}
+}
+
+// Postpone stops the run with a *HumanInputRequiredError so that it can be
+// resumed from its last checkpoint once the answer is known
+func (e InputRequested) Postpone() {
+	select {
+	case e.reply <- inputReply{postponed: true}:
+	default:
+	}
+}
+
+// PlanUpdated is sent with the whole plan whenever an agent creates or
+// updates it
+type PlanUpdated struct {
+	Agent string
+	Plan  []planning.Task
+}
+
+// Handover is sent when an agent has completed its work and To, an agent or
+// End, runs next
+type Handover struct {
+	From    string
+	To      string
+	Summary string
+}
+
+// RunCompleted is the last event of a run that reached End
+type RunCompleted struct {
+	WorkflowID string
+	State      WorkflowState
+}
+
+// RunFailed is the last event of a run that stopped before reaching End.
+// Err is a *BudgetExceededError when a budget was exceeded, a
+// *HumanInputRequiredError when a question was postponed and the context's
+// error when the run was cancelled. State is the state when the run stopped.
+type RunFailed struct {
+	WorkflowID string
+	State      WorkflowState
+	Reason     StopReason
+	Err        error
+}
+
+func (NodeStarted) isEvent()       {}
+func (ModelDelta) isEvent()        {}
+func (ModelResponded) isEvent()    {}
+func (ToolCalled) isEvent()        {}
+func (ToolReturned) isEvent()      {}
+func (ApprovalRequested) isEvent() {}
+func (InputRequested) isEvent()    {}
+func (PlanUpdated) isEvent()       {}
+func (Handover) isEvent()          {}
+func (RunCompleted) isEvent()      {}
+func (RunFailed) isEvent()         {}
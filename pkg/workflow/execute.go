@@ -6,29 +6,114 @@ import (
 	"clan/pkg/llm"
 	"clan/pkg/planning"
 	"clan/pkg/tools"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"slices"
 )
 
-var NoAgentsDefinedErr = errors.New("no agents defined")
+var (
+	NoAgentsDefinedErr       = errors.New("no agents defined")
+	NoCheckpointerDefinedErr = errors.New("no checkpoint defined in the workflow definition")
+	WorkflowCompletedErr     = errors.New("workflow has already completed")
+)
+
+// Execute runs the workflow in the background and returns a handle to follow
+// its events and wait for its result. Cancelling ctx stops the run at its
+// last checkpoint.
+func Execute(ctx context.Context, definition *WorkflowDefinition, workflowID string) (*Run, error) {
+	events := make(chan Event)
+	ws, graph, err := buildGraph(definition, events)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpointProvider, err := newCheckpointer(definition)
+	if err != nil {
+		return nil, err
+	}
+
+	return run(ctx, definition, ws, graph, events, clan.ExecuteOptions{
+		Checkpointer: checkpointProvider,
+		WorkflowID:   workflowID,
+	}), nil
+}
+
+// Resume restores the state stored in the last checkpoint for workflowID and
+// continues execution from the node that was about to run when it was taken
+func Resume(ctx context.Context, definition *WorkflowDefinition, workflowID string) (*Run, error) {
+	checkpointProvider, cp, err := lastCheckpoint(definition, workflowID)
+	if err != nil {
+		return nil, err
+	}
+
+	if cp.NodeName == clan.End {
+		return nil, WorkflowCompletedErr
+	}
+
+	events := make(chan Event)
+	ws, graph, err := buildGraph(definition, events)
+	if err != nil {
+		return nil, err
+	}
+
+	*ws = WorkflowState{}
+	err = json.Unmarshal([]byte(cp.State), ws)
+	if err != nil {
+		return nil, err
+	}
 
-func Execute(definition *WorkflowDefinition, workflowID string) (chan interface{}, error) {
-	streamChannel := make(chan interface{})
+	return run(ctx, definition, ws, graph, events, clan.ExecuteOptions{
+		Checkpointer: checkpointProvider,
+		WorkflowID:   workflowID,
+		StartNode:    cp.NodeName,
+		StartDepth:   cp.CurrentDepth,
+	}), nil
+}
+
+// buildGraph creates a graph with a node for every agent and its tools. The
+// nodes send the events of the run on events.
+func buildGraph(definition *WorkflowDefinition, events chan Event) (*WorkflowState, *clan.ClanGraph[WorkflowState], error) {
 	ws := WorkflowState{
 		AgentHistory: make(map[string][]llm.Message),
 	}
 
 	if len(definition.Agents) == 0 {
-		return nil, NoAgentsDefinedErr
+		return nil, nil, NoAgentsDefinedErr
+	}
+
+	err := definition.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var cassette *llm.Cassette
+	if definition.Cassette != nil {
+		var err error
+		cassette, err = llm.OpenCassette(definition.Cassette.Path, definition.Cassette.Mode)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
+	limiters := map[string]*llm.Limiter{}
+	prices := &pricer{definition: definition, unpriced: map[string]bool{}}
+
 	graph := clan.NewClanGraph(&ws)
 	for _, agent := range definition.Agents {
+		if agent.Type == AgentTypeHuman {
+			graph.AddNode(agent.Name, humanNode(definition, &agent, events))
+			err = graph.AddConditionalEdge(agent.Name, humanNextAgent(&agent, events))
+			if err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
 		sysPrompt, err := generateSystemPrompt(agent.SystemPrompt, definition)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		ws.AgentHistory[agent.Name] = []llm.Message{
@@ -57,7 +142,7 @@ func Execute(definition *WorkflowDefinition, workflowID string) (chan interface{
 		llmTools := []llm.Tool{}
 		for _, agentTool := range agent.AvailableTools {
 			toolFound := false
-			for _, toolRef := range tools.AllTools(definition.Tools) {
+			for _, toolRef := range tools.AllTools(definition.workspace(&agent), definition.commands(&agent), definition.Tools) {
 				if agentTool == toolRef.Name() {
 					toolFound = true
 					llmTools = append(llmTools, toolRef.Schema())
@@ -65,13 +150,55 @@ func Execute(definition *WorkflowDefinition, workflowID string) (chan interface{
 				}
 			}
 			if !toolFound {
-				return nil, fmt.Errorf("invalid tool %s", agentTool)
+				return nil, nil, fmt.Errorf("invalid tool %s", agentTool)
+			}
+		}
+
+		providerOptions := &llm.ProviderOptions{
+			Model:   agent.Model,
+			BaseURL: agent.BaseURL,
+			Tools:   llmTools,
+			Agent:   agent.Name,
+			Fixture: agent.Fixture,
+
+			Temperature:   agent.Temperature,
+			TopP:          agent.TopP,
+			TopK:          agent.TopK,
+			MaxTokens:     agent.MaxTokens,
+			StopSequences: agent.StopSequences,
+		}
+
+		providerName := agent.Provider
+		if providerName == "" {
+			providerName = llm.DefaultProvider
+		}
+		providerDef := definition.Providers[providerName]
+		if _, exists := limiters[providerName]; !exists {
+			limiters[providerName] = llm.NewLimiter(providerDef.MaxConcurrency, providerDef.RequestsPerMinute)
+		}
+		providerOptions.Timeout = providerDef.Timeout
+		providerOptions.MaxRetries = providerDef.MaxRetries
+		providerOptions.Limiter = limiters[providerName]
+
+		var model llm.LLM
+		if cassette == nil || cassette.Mode() != llm.CassetteReplay {
+			model, err = llm.NewLLMWithName(agent.Provider, providerOptions)
+			if err != nil {
+				return nil, nil, fmt.Errorf("agent %s: %w", agent.Name, err)
 			}
 		}
 
-		model := llm.NewAnthropic(&llm.AnthropicOptions{Model: agent.Model, Tools: llmTools})
+		if cassette != nil {
+			model = cassette.Wrap(model, providerOptions)
+		}
+
+		graph.AddNode(agent.Name, withDurationBudget(definition, &agent, func(ctx context.Context, ws *WorkflowState) (*WorkflowState, error) {
+			err := ws.checkBudgets(definition, &agent, 0)
+			if err != nil {
+				return nil, err
+			}
+			events <- NodeStarted{Node: agent.Name, Agent: agent.Name}
 
-		graph.AddNode(agent.Name, func(ws *WorkflowState) (*WorkflowState, error) {
 			if len(ws.Summaries) > 0 && agent.Name != ws.CurrentAgent {
 				summaryBytes, err := json.Marshal(ws.Summaries)
 				if err != nil {
@@ -106,69 +233,148 @@ func Execute(definition *WorkflowDefinition, workflowID string) (chan interface{
 
 			// log.Printf("HISTORY SENT TO THE MODEL IS %+v\n", ws.AgentHistory[agent.Name])
 
-			resp, err := model.Generate(ws.AgentHistory[agent.Name])
+			var resp *llm.Response
+			streamer, streamed := model.(llm.StreamingLLM)
+			if streamed {
+				resp, err = streamer.GenerateStream(ctx, ws.AgentHistory[agent.Name], func(delta llm.Delta) {
+					events <- ModelDelta{AgentName: agent.Name, Delta: delta}
+				})
+			} else {
+				resp, err = model.Generate(ctx, ws.AgentHistory[agent.Name])
+			}
 			if err != nil {
 				return nil, err
 			}
 			// log.Printf("Response from LLM %+v", resp)
 
-			ws.AgentHistory[agent.Name] = append(ws.AgentHistory[agent.Name], resp...)
+			cost := prices.cost(&agent, resp)
+			ws.addUsage(agent.Name, resp.Usage, cost)
+
+			ws.AgentHistory[agent.Name] = append(ws.AgentHistory[agent.Name], resp.Messages...)
+			events <- ModelResponded{Agent: agent.Name, Messages: resp.Messages, Usage: resp.Usage, Cost: cost, Streamed: streamed}
 			return ws, nil
-		})
+		}))
 
 		toolsNodeName := fmt.Sprintf("%s_tools", agent.Name)
 
-		graph.AddNode(toolsNodeName, func(ws *WorkflowState) (*WorkflowState, error) {
+		graph.AddNode(toolsNodeName, withDurationBudget(definition, &agent, func(ctx context.Context, ws *WorkflowState) (*WorkflowState, error) {
 
 			ws.completionMarkerCalled = false
 			ws.toolInvoked = false
 
-			// Identify which tool was called
+			// Identify which tool was called. A run resumed after a question
+			// was postponed already has the results of the calls before it.
 			agentsHistory := ws.AgentHistory[agent.Name]
-			lastItemFromHistory := agentsHistory[len(agentsHistory)-1]
+			turn := len(agentsHistory) - 1
+			for turn > 0 && agentsHistory[turn].Role != "assistant" {
+				turn--
+			}
+			lastItemFromHistory := agentsHistory[turn]
+			completed := map[string]llm.Content{}
+			for _, m := range agentsHistory[turn+1:] {
+				for _, c := range m.Content {
+					if c.ContentType == "tool_result" {
+						completed[c.ToolUseId] = c
+					}
+				}
+			}
+
+			pendingToolCalls := 0
+			for _, contentNode := range lastItemFromHistory.Content {
+				if contentNode.ContentType == "tool_use" {
+					if _, done := completed[contentNode.Id]; !done {
+						pendingToolCalls++
+					}
+				}
+			}
+			err := ws.checkBudgets(definition, &agent, pendingToolCalls)
+			if err != nil {
+				return nil, err
+			}
+			events <- NodeStarted{Node: toolsNodeName, Agent: agent.Name}
+
 			// log.Printf("agentsHistory is %+v", agentsHistory)
 			// log.Printf("lastItemFromHistory is %s", lastItemFromHistory)
+			commands := definition.commands(&agent)
+			commands.Approver = ws.approver(agent.Name, events)
+
 			agentDidNotCallAnyTool := true
 			for _, contentNode := range lastItemFromHistory.Content {
 				if contentNode.ContentType == "tool_use" {
 					agentDidNotCallAnyTool = false
+					if result, done := completed[contentNode.Id]; done {
+						ws.toolInvoked = true
+						if contentNode.Name == "NextAgentSelector" && !result.IsError {
+							ws.completionMarkerCalled = true
+						}
+						continue
+					}
+
 					toolFound := false
-					for _, t := range tools.AllTools(definition.Tools) {
-						if t.Name() == contentNode.Name {
+					for _, t := range tools.AllTools(definition.workspace(&agent), commands, definition.Tools) {
+						if t.Name() == contentNode.Name && contentNode.RawInput == "" {
 							// log.Printf("Tool called %s", t.Name())
 							// Call tool function
-							result, err := t.Execute(contentNode.Input)
+							events <- ToolCalled{Agent: agent.Name, Tool: t.Name(), ToolUseID: contentNode.Id, Input: contentNode.Input}
+							var result string
+							var isError bool
+							if t.Name() == "AskHuman" {
+								result, isError, err = askHumanTool(ctx, events, agent.Name, contentNode.Id, contentNode.Input, ws)
+							} else {
+								result, isError, err = executeTool(ctx, agent.Name, t, contentNode.Input, definition.ToolPolicies[t.Name()])
+							}
 							if err != nil {
 								return nil, err
 							}
+							ws.addToolCall(agent.Name)
+
+							if isError {
+								events <- ToolReturned{Agent: agent.Name, Tool: t.Name(), ToolUseID: contentNode.Id, Result: result, IsError: true}
+								ws.AgentHistory[agent.Name] = append(ws.AgentHistory[agent.Name], llm.Message{
+									Role: "user",
+									Content: []llm.Content{
+										{
+											Content:     result,
+											ContentType: "tool_result",
+											ToolUseId:   contentNode.Id,
+											IsError:     true,
+										},
+									},
+								})
+								toolFound = true
+								ws.toolInvoked = true
+								continue
+							}
 
 							if t.Name() == "NextAgentSelector" {
 								ws.completionMarkerCalled = true
 								// Update state with summary
 								ws.Summaries = append(ws.Summaries, Summary{
 									AgentName: agent.Name,
-									Summary:   contentNode.Input["summary"].(string),
+									Summary:   result,
 								})
 
-								requestedNextAgent := contentNode.Input["next_agent"]
-								ws.RequestedNextAgent = requestedNextAgent.(string)
+								// A missing next_agent hands over like an empty one
+								ws.RequestedNextAgent, _ = contentNode.Input["next_agent"].(string)
 							}
 
 							if t.Name() == "PlanCreator" {
 								pc := t.(*planning.CreatePlan)
 								ws.Plan = pc.CurrentPlan
+								events <- PlanUpdated{Agent: agent.Name, Plan: slices.Clone(ws.Plan)}
 							}
 
 							if t.Name() == "PlanUpdater" {
-								// Find the task
+								// Find the task, updates missing its name or status are skipped
+								name, hasName := contentNode.Input["taskName"].(string)
+								status, hasStatus := contentNode.Input["status"].(string)
 								for i := range ws.Plan {
-									name := contentNode.Input["taskName"].(string)
-									if name == ws.Plan[i].Name {
+									if hasName && hasStatus && name == ws.Plan[i].Name {
 										// Update the status of the task
-										status := contentNode.Input["status"].(string)
 										ws.Plan[i].Status = status
 									}
 								}
+								events <- PlanUpdated{Agent: agent.Name, Plan: slices.Clone(ws.Plan)}
 							}
 
 							if t.Name() == "GetPlan" {
@@ -181,6 +387,8 @@ func Execute(definition *WorkflowDefinition, workflowID string) (chan interface{
 								result = string(planBytes)
 							}
 
+							events <- ToolReturned{Agent: agent.Name, Tool: t.Name(), ToolUseID: contentNode.Id, Result: result}
+
 							// Write result to history
 							ws.AgentHistory[agent.Name] = append(ws.AgentHistory[agent.Name], llm.Message{
 								Role: "user",
@@ -197,9 +405,27 @@ func Execute(definition *WorkflowDefinition, workflowID string) (chan interface{
 						}
 					}
 
+					// Let the model correct a call to a tool that does not exist or
+					// whose input is not valid JSON
 					if !toolFound {
-						return nil, fmt.Errorf(
-							"invalid tool call by LLM %s", contentNode.Name)
+						message := fmt.Sprintf("Error: invalid tool call by LLM %s", contentNode.Name)
+						if contentNode.RawInput != "" {
+							message = fmt.Sprintf("Error: the input of %s must be a JSON object, got: %s", contentNode.Name, contentNode.RawInput)
+						}
+						events <- ToolCalled{Agent: agent.Name, Tool: contentNode.Name, ToolUseID: contentNode.Id, Input: contentNode.Input}
+						events <- ToolReturned{Agent: agent.Name, Tool: contentNode.Name, ToolUseID: contentNode.Id, Result: message, IsError: true}
+						ws.AgentHistory[agent.Name] = append(ws.AgentHistory[agent.Name], llm.Message{
+							Role: "user",
+							Content: []llm.Content{
+								{
+									Content:     message,
+									ContentType: "tool_result",
+									ToolUseId:   contentNode.Id,
+									IsError:     true,
+								},
+							},
+						})
+						ws.toolInvoked = true
 					}
 				}
 			}
@@ -217,25 +443,30 @@ func Execute(definition *WorkflowDefinition, workflowID string) (chan interface{
 			}
 
 			return ws, nil
-		})
+		}))
 
 		err = graph.AddEdge(agent.Name, toolsNodeName)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		err = graph.AddConditionalEdge(toolsNodeName, func(ws *WorkflowState) (string, error) {
 			// If goal complete tool was called then go to next node
 			if ws.completionMarkerCalled {
-
-				if ws.RequestedNextAgent != "" {
-					return ws.RequestedNextAgent, nil
-				} else if agent.NextAgent != "" {
-					return agent.NextAgent, nil
+				next := ws.RequestedNextAgent
+				if next == "" {
+					next = agent.NextAgent
+				}
+				if next == "" {
+					var err error
+					next, err = executeNextAgentFn(agent.NextAgentFunction, ws)
+					if err != nil {
+						return "", err
+					}
 				}
 
-				return executeNextAgentFn(agent.NextAgentFunction, ws)
-				// return agent.NextAgent, nil
+				events <- Handover{From: agent.Name, To: next, Summary: ws.Summaries[len(ws.Summaries)-1].Summary}
+				return next, nil
 			}
 
 			// If no tool called then go back to LLM saying what is next
@@ -243,35 +474,65 @@ func Execute(definition *WorkflowDefinition, workflowID string) (chan interface{
 		})
 	}
 
-	graph.SetStartNode(definition.StartAgent)
-	go func() {
-		traversalDepth := 100
-		if definition.TraversalDepth > 0 {
-			traversalDepth = definition.TraversalDepth
-		}
+	err = graph.SetStartNode(definition.StartAgent)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		var checkpointProvider checkpointer.Checkpointer
-		var err error
-		if definition.Checkpoint != nil {
-			checkpointProvider, err = checkpointer.NewCheckpointerWithName(definition.Checkpoint.Type, definition.Checkpoint.ConnectionString)
-			if err != nil {
-				log.Printf("Could not setup checkpointer %s", err)
+	return &ws, graph, nil
+}
+
+func newCheckpointer(definition *WorkflowDefinition) (checkpointer.Checkpointer, error) {
+	if definition.Checkpoint == nil {
+		return nil, nil
+	}
+
+	return checkpointer.NewCheckpointerWithName(definition.Checkpoint.Type, definition.Checkpoint.ConnectionString)
+}
+
+// run executes the graph in the background and sends RunCompleted or
+// RunFailed once it has stopped
+func run(ctx context.Context, definition *WorkflowDefinition, ws *WorkflowState, graph *clan.ClanGraph[WorkflowState], events chan Event, options clan.ExecuteOptions) *Run {
+	options.TraversalDepth = 100
+	if definition.TraversalDepth > 0 {
+		options.TraversalDepth = definition.TraversalDepth
+	}
+	options.InterruptBefore = definition.InterruptBefore
+	options.InterruptAfter = definition.InterruptAfter
+
+	r := &Run{
+		WorkflowID: options.WorkflowID,
+		events:     events,
+		done:       make(chan struct{}),
+	}
+
+	go func() {
+		defer close(r.done)
+		defer close(events)
+
+		_, err := graph.Execute(ctx, options)
+
+		// The tool calls that completed before a question was postponed are
+		// kept so that resuming only asks the question
+		var inputErr *HumanInputRequiredError
+		if errors.As(err, &inputErr) && options.Checkpointer != nil {
+			saveErr := saveState(options.Checkpointer, options.WorkflowID, ws)
+			if saveErr != nil {
+				err = errors.Join(err, saveErr)
 			}
 		}
 
-		_, err = graph.Execute(clan.ExecuteOptions{
-			StreamChannel:  streamChannel,
-			TraversalDepth: traversalDepth,
-			Checkpointer:   checkpointProvider,
-			WorkflowID:     workflowID,
-		})
+		r.result = Result{WorkflowID: options.WorkflowID, State: *ws, Reason: stopReason(err)}
+		r.err = err
 		if err != nil {
-			log.Printf("Error occured during execution %s", err)
+			events <- RunFailed{WorkflowID: options.WorkflowID, State: *ws, Reason: r.result.Reason, Err: err}
+			return
 		}
+
+		events <- RunCompleted{WorkflowID: options.WorkflowID, State: *ws}
 	}()
 
-	// log.Printf("State is %+v", state)
-	return streamChannel, nil
+	return r
 }
 
 type WorkflowState struct {
@@ -279,9 +540,15 @@ type WorkflowState struct {
 	Summaries              []Summary
 	CurrentAgent           string
 	Plan                   []planning.Task
+	AgentUsage             map[string]UsageSummary
+	TotalUsage             UsageSummary
 	toolInvoked            bool
 	completionMarkerCalled bool
 	RequestedNextAgent     string
+	// Approvals are the decisions taken on commands needing approval
+	Approvals []CommandApproval
+	// PendingInput is the question the run stopped waiting for an answer to
+	PendingInput *PendingInput
 }
 
 type Summary struct {
@@ -0,0 +1,526 @@
+package workflow
+
+import (
+	"clan/pkg/checkpointer"
+	"clan/pkg/clan"
+	"clan/pkg/llm"
+	"clan/pkg/tools"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestExecuteWithMockProvider(t *testing.T) {
+	def := loadDefinition(t, "testdata/software.yaml")
+	connectionString := filepath.Join(t.TempDir(), "checkpoints.db")
+	def.Checkpoint = &CheckpointDefinition{Type: "sqlite3", ConnectionString: connectionString}
+
+	r, err := Execute(context.Background(), def, "software")
+	require.NoError(t, err)
+
+	nodes, final := drain(r)
+	require.Equal(t, []string{
+		"Planner", "Planner_tools", "Planner", "Planner_tools",
+		"Programmer", "Programmer_tools", "Programmer", "Programmer_tools", "Programmer", "Programmer_tools",
+		"Reviewer", "Reviewer_tools", "Reviewer", "Reviewer_tools", "Reviewer", "Reviewer_tools",
+	}, nodes)
+
+	require.Equal(t, []Summary{
+		{AgentName: "Planner", Summary: "Created a plan with two tasks"},
+		{AgentName: "Programmer", Summary: "Wrote primes.py"},
+		{AgentName: "Reviewer", Summary: "Reviewed primes.py"},
+	}, final.Summaries)
+
+	require.Equal(t, 8, final.TotalUsage.Calls)
+	require.Equal(t, 3000, final.TotalUsage.InputTokens)
+	require.Equal(t, 300, final.TotalUsage.OutputTokens)
+	require.Equal(t, 10000, final.TotalUsage.CacheReadInputTokens)
+	require.Equal(t, 2, final.AgentUsage["Planner"].Calls)
+	require.Equal(t, 1000, final.AgentUsage["Planner"].InputTokens)
+	require.Equal(t, float64(0), final.AgentUsage["Planner"].Cost)
+	require.InDelta(t, 0.012, final.AgentUsage["Programmer"].Cost, 0.000001)
+	require.InDelta(t, 0.012, final.TotalUsage.Cost, 0.000001)
+
+	require.Equal(t, 2, len(final.Plan))
+	require.Equal(t, "Completed", final.Plan[0].Status)
+	require.Equal(t, "Completed", final.Plan[1].Status)
+
+	// GetPlan returns the plan created by the Planner
+	programmerHistory := final.AgentHistory["Programmer"]
+	require.Contains(t, programmerHistory[len(programmerHistory)-5].Content[0].Content, "Write program")
+
+	cp, err := checkpointer.NewSQLite(connectionString)
+	require.NoError(t, err)
+	last, err := cp.GetLastCheckpoint("software")
+	require.NoError(t, err)
+	require.Equal(t, clan.End, last.NodeName)
+	require.Equal(t, 16, last.CurrentDepth)
+}
+
+func TestExecuteSendsEvents(t *testing.T) {
+	def := loadDefinition(t, "testdata/software.yaml")
+
+	r, err := Execute(context.Background(), def, "software")
+	require.NoError(t, err)
+
+	var handovers []Handover
+	var plans []PlanUpdated
+	var calls []ToolCalled
+	var returns []ToolReturned
+	var responses []ModelResponded
+	var completed *RunCompleted
+	for event := range r.Events() {
+		require.Nil(t, completed, "no event is sent after RunCompleted")
+		switch e := event.(type) {
+		case Handover:
+			handovers = append(handovers, e)
+		case PlanUpdated:
+			plans = append(plans, e)
+		case ToolCalled:
+			calls = append(calls, e)
+		case ToolReturned:
+			returns = append(returns, e)
+		case ModelResponded:
+			responses = append(responses, e)
+		case RunCompleted:
+			completed = &e
+		}
+	}
+
+	require.Equal(t, []Handover{
+		{From: "Planner", To: "Programmer", Summary: "Created a plan with two tasks"},
+		{From: "Programmer", To: "Reviewer", Summary: "Wrote primes.py"},
+		{From: "Reviewer", To: clan.End, Summary: "Reviewed primes.py"},
+	}, handovers)
+
+	require.Equal(t, 3, len(plans))
+	require.Equal(t, "Planner", plans[0].Agent)
+	require.Equal(t, "Not Started", plans[0].Plan[0].Status)
+	require.Equal(t, "Completed", plans[2].Plan[1].Status)
+
+	require.Equal(t, 8, len(responses))
+	require.Equal(t, "Planner", responses[0].Agent)
+	require.Equal(t, 7, len(calls))
+	require.Equal(t, len(calls), len(returns))
+	require.Equal(t, "PlanCreator", calls[0].Tool)
+	require.Equal(t, calls[0].ToolUseID, returns[0].ToolUseID)
+	require.False(t, returns[0].IsError)
+
+	require.NotNil(t, completed)
+	require.Equal(t, "software", completed.WorkflowID)
+	require.Equal(t, 3, len(completed.State.Summaries))
+
+	result, err := r.Wait()
+	require.NoError(t, err)
+	require.Equal(t, StopCompleted, result.Reason)
+	require.Equal(t, completed.State.Summaries, result.State.Summaries)
+}
+
+func TestWaitWithoutReadingEvents(t *testing.T) {
+	def := loadDefinition(t, "testdata/software.yaml")
+	def.Budget = &BudgetDefinition{MaxTokens: 2000}
+
+	r, err := Execute(context.Background(), def, "software")
+	require.NoError(t, err)
+
+	result, err := r.Wait()
+	require.ErrorIs(t, err, BudgetExceededErr)
+	require.Equal(t, "software", result.WorkflowID)
+	require.Equal(t, StopBudgetExceeded, result.Reason)
+	require.Equal(t, 3, result.State.TotalUsage.Calls)
+
+	// Waiting again returns the same result
+	again, err := r.Wait()
+	require.ErrorIs(t, err, BudgetExceededErr)
+	require.Equal(t, result.Reason, again.Reason)
+}
+
+func TestResumeWithMockProvider(t *testing.T) {
+	def := loadDefinition(t, "testdata/software.yaml")
+	def.Checkpoint = &CheckpointDefinition{Type: "sqlite3", ConnectionString: filepath.Join(t.TempDir(), "checkpoints.db")}
+
+	// Stop the run once the Planner has handed over to the Programmer
+	def.TraversalDepth = 4
+	r, err := Execute(context.Background(), def, "software")
+	require.NoError(t, err)
+	nodes, _ := drain(r)
+	require.Equal(t, 4, len(nodes))
+
+	result, err := r.Wait()
+	require.ErrorIs(t, err, clan.TraversalDepthExceededErr)
+	require.Equal(t, StopTraversalDepth, result.Reason)
+	require.True(t, result.Reason.Resumable())
+
+	def.TraversalDepth = 0
+	r, err = Resume(context.Background(), def, "software")
+	require.NoError(t, err)
+
+	nodes, final := drain(r)
+	require.Equal(t, 12, len(nodes))
+	require.Equal(t, "Programmer", nodes[0])
+	require.Equal(t, 3, len(final.Summaries))
+	require.Equal(t, "Planner", final.Summaries[0].AgentName)
+	require.Equal(t, 2, len(final.Plan))
+
+	// Usage recorded before the checkpoint is restored with the state
+	require.Equal(t, 8, final.TotalUsage.Calls)
+	require.Equal(t, 3000, final.TotalUsage.InputTokens)
+}
+
+func TestResumeCompletedWorkflow(t *testing.T) {
+	def := loadDefinition(t, "testdata/software.yaml")
+	def.Checkpoint = &CheckpointDefinition{Type: "sqlite3", ConnectionString: filepath.Join(t.TempDir(), "checkpoints.db")}
+
+	r, err := Execute(context.Background(), def, "software")
+	require.NoError(t, err)
+	drain(r)
+
+	_, err = Resume(context.Background(), def, "software")
+	require.ErrorIs(t, err, WorkflowCompletedErr)
+}
+
+func TestResumeWithoutCheckpoint(t *testing.T) {
+	def := loadDefinition(t, "testdata/software.yaml")
+
+	_, err := Resume(context.Background(), def, "software")
+	require.ErrorIs(t, err, NoCheckpointerDefinedErr)
+}
+
+func TestExecuteStopsWhenWorkflowBudgetExceeded(t *testing.T) {
+	def := loadDefinition(t, "testdata/software.yaml")
+	connectionString := filepath.Join(t.TempDir(), "checkpoints.db")
+	def.Checkpoint = &CheckpointDefinition{Type: "sqlite3", ConnectionString: connectionString}
+	def.Budget = &BudgetDefinition{MaxTokens: 2000}
+
+	r, err := Execute(context.Background(), def, "software")
+	require.NoError(t, err)
+
+	nodes, failed := drainFailed(t, r)
+	require.Equal(t, []string{"Planner", "Planner_tools", "Planner", "Planner_tools", "Programmer"}, nodes)
+	require.Equal(t, "software", failed.WorkflowID)
+	require.ErrorIs(t, failed.Err, BudgetExceededErr)
+
+	var exceeded *BudgetExceededError
+	require.ErrorAs(t, failed.Err, &exceeded)
+	require.Equal(t, "", exceeded.AgentName)
+	require.Equal(t, "max_tokens", exceeded.Limit)
+	require.Equal(t, float64(13300), exceeded.Used)
+	require.Equal(t, 13300, failed.State.TotalUsage.InputTokens+failed.State.TotalUsage.OutputTokens+failed.State.TotalUsage.CacheReadInputTokens)
+
+	cp, err := checkpointer.NewSQLite(connectionString)
+	require.NoError(t, err)
+	last, err := cp.GetLastCheckpoint("software")
+	require.NoError(t, err)
+	require.Equal(t, "Programmer_tools", last.NodeName)
+
+	// Raising the budget lets the run be resumed to completion
+	def.Budget = nil
+	r, err = Resume(context.Background(), def, "software")
+	require.NoError(t, err)
+	nodes, final := drain(r)
+	require.Equal(t, "Programmer_tools", nodes[0])
+	require.Equal(t, 3, len(final.Summaries))
+
+	last, err = cp.GetLastCheckpoint("software")
+	require.NoError(t, err)
+	require.Equal(t, clan.End, last.NodeName)
+}
+
+func TestExecuteStopsWhenAgentToolCallBudgetExceeded(t *testing.T) {
+	def := loadDefinition(t, "testdata/software.yaml")
+	def.Agents[1].Budget = &BudgetDefinition{MaxToolCalls: 1}
+
+	r, err := Execute(context.Background(), def, "software")
+	require.NoError(t, err)
+
+	_, failed := drainFailed(t, r)
+	var exceeded *BudgetExceededError
+	require.ErrorAs(t, failed.Err, &exceeded)
+	require.Equal(t, "Programmer", exceeded.AgentName)
+	require.Equal(t, "max_tool_calls", exceeded.Limit)
+	require.Equal(t, 1, failed.State.AgentUsage["Programmer"].ToolCalls)
+}
+
+func TestExecuteStopsCommandsThatRunPastMaxDuration(t *testing.T) {
+	def := loadDefinition(t, "testdata/commands.yaml")
+	def.Workspace = t.TempDir()
+	def.Agents[0].Commands.Allow = append(def.Agents[0].Commands.Allow, "sleep")
+	def.Agents[0].Budget = &BudgetDefinition{MaxDuration: 200 * time.Millisecond}
+
+	def.Agents[0].Fixture = filepath.Join(t.TempDir(), "fixture.yaml")
+	fixture := "agents:\n  Worker:\n  - content:\n    - type: tool_use\n      id: sleep\n      name: CommandRunner\n      input:\n        command: sleep 30\n"
+	require.NoError(t, os.WriteFile(def.Agents[0].Fixture, []byte(fixture), 0o644))
+
+	start := time.Now()
+	r, err := Execute(context.Background(), def, "commands")
+	require.NoError(t, err)
+
+	nodes, failed := drainFailed(t, r)
+	require.Less(t, time.Since(start), 10*time.Second)
+	require.Equal(t, []string{"Worker", "Worker_tools"}, nodes)
+	require.Equal(t, StopBudgetExceeded, failed.Reason)
+
+	var exceeded *BudgetExceededError
+	require.ErrorAs(t, failed.Err, &exceeded)
+	require.Equal(t, "Worker", exceeded.AgentName)
+	require.Equal(t, "max_duration", exceeded.Limit)
+	require.GreaterOrEqual(t, exceeded.Used, 0.2)
+}
+
+func TestExecuteCancelled(t *testing.T) {
+	def := loadDefinition(t, "testdata/software.yaml")
+	connectionString := filepath.Join(t.TempDir(), "checkpoints.db")
+	def.Checkpoint = &CheckpointDefinition{Type: "sqlite3", ConnectionString: connectionString}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := Execute(ctx, def, "software")
+	require.NoError(t, err)
+
+	var failed *RunFailed
+	nodes := 0
+	for event := range r.Events() {
+		switch e := event.(type) {
+		case NodeStarted:
+			nodes++
+			if nodes == 2 {
+				cancel()
+			}
+		case RunFailed:
+			failed = &e
+		}
+	}
+
+	require.NotNil(t, failed)
+	require.Equal(t, "software", failed.WorkflowID)
+	require.ErrorIs(t, failed.Err, context.Canceled)
+
+	cp, err := checkpointer.NewSQLite(connectionString)
+	require.NoError(t, err)
+	last, err := cp.GetLastCheckpoint("software")
+	require.NoError(t, err)
+	require.NotEqual(t, clan.End, last.NodeName)
+
+	r, err = Resume(context.Background(), def, "software")
+	require.NoError(t, err)
+	_, final := drain(r)
+	require.Equal(t, 3, len(final.Summaries))
+}
+
+func TestExecuteRecordAndReplayCassette(t *testing.T) {
+	cassettePath := filepath.Join(t.TempDir(), "software.cassette.json")
+
+	def := loadDefinition(t, "testdata/software.yaml")
+	def.Cassette = &CassetteDefinition{Mode: "record", Path: cassettePath}
+	r, err := Execute(context.Background(), def, "software")
+	require.NoError(t, err)
+	recordedNodes, recorded := drain(r)
+
+	// Replaying does not need the underlying provider
+	def = loadDefinition(t, "testdata/software.yaml")
+	def.Cassette = &CassetteDefinition{Mode: "replay", Path: cassettePath}
+	for i := range def.Agents {
+		def.Agents[i].Provider = "anthropic"
+	}
+	r, err = Execute(context.Background(), def, "software")
+	require.NoError(t, err)
+	replayedNodes, replayed := drain(r)
+
+	require.Equal(t, recordedNodes, replayedNodes)
+	require.Equal(t, recorded.Summaries, replayed.Summaries)
+	require.Equal(t, recorded.Plan, replayed.Plan)
+	// Durations are wall clock time and differ between runs
+	require.Equal(t, recorded.TotalUsage.Usage, replayed.TotalUsage.Usage)
+	require.Equal(t, recorded.TotalUsage.Calls, replayed.TotalUsage.Calls)
+	require.Equal(t, recorded.TotalUsage.Cost, replayed.TotalUsage.Cost)
+	require.Equal(t, recorded.TotalUsage.ToolCalls, replayed.TotalUsage.ToolCalls)
+}
+
+func TestExecuteReportsToolErrorsToTheModel(t *testing.T) {
+	def := loadDefinition(t, "testdata/tool_errors.yaml")
+
+	r, err := Execute(context.Background(), def, "tool-errors")
+	require.NoError(t, err)
+
+	nodes, final := drain(r)
+	require.Equal(t, []string{"Worker", "Worker_tools", "Worker", "Worker_tools", "Worker", "Worker_tools", "Worker", "Worker_tools"}, nodes)
+	require.Equal(t, 1, len(final.Summaries))
+	require.Equal(t, "Recovered from the failing tool", final.Summaries[0].Summary)
+
+	var results []llm.Content
+	for _, m := range final.AgentHistory["Worker"] {
+		for _, c := range m.Content {
+			if c.ContentType == "tool_result" {
+				results = append(results, c)
+			}
+		}
+	}
+	require.Equal(t, 6, len(results))
+	require.True(t, results[0].IsError)
+	require.Contains(t, results[0].Content, "boom")
+	require.True(t, results[1].IsError)
+	require.Contains(t, results[1].Content, "invalid tool call by LLM Missing")
+
+	// Calls missing parameters are returned to the model as errors or skipped
+	require.True(t, results[2].IsError)
+	require.Equal(t, "Error: missing parameter summary", results[2].Content)
+	require.False(t, results[3].IsError)
+	require.True(t, results[4].IsError)
+	require.Equal(t, `Error: the input of Writer must be a JSON object, got: {"filepath": "a.txt"`, results[4].Content)
+	require.False(t, results[5].IsError)
+}
+
+func TestExecuteAbortsOnToolErrorWithAbortPolicy(t *testing.T) {
+	def := loadDefinition(t, "testdata/tool_errors.yaml")
+	def.ToolPolicies = map[string]ToolPolicyDefinition{
+		"Explode": {OnError: ToolErrorAbort},
+	}
+
+	r, err := Execute(context.Background(), def, "tool-errors")
+	require.NoError(t, err)
+
+	nodes, failed := drainFailed(t, r)
+	require.Equal(t, []string{"Worker", "Worker_tools"}, nodes)
+	require.Equal(t, "tool-errors", failed.WorkflowID)
+	require.Equal(t, StopFailed, failed.Reason)
+	var toolErr *ToolError
+	require.ErrorAs(t, failed.Err, &toolErr)
+	require.Equal(t, "Explode", toolErr.ToolName)
+	require.ErrorContains(t, failed.Err, "boom")
+}
+
+func TestExecuteAsksForCommandApproval(t *testing.T) {
+	def := loadDefinition(t, "testdata/commands.yaml")
+	def.Workspace = t.TempDir()
+
+	r, err := Execute(context.Background(), def, "commands")
+	require.NoError(t, err)
+
+	requested := []string{}
+	results := map[string]ToolReturned{}
+	for event := range r.Events() {
+		switch e := event.(type) {
+		case ApprovalRequested:
+			requested = append(requested, e.Command)
+			switch e.Command {
+			case "printf edit":
+				e.Respond(tools.Approval{Approved: true, Command: "printf edited"})
+			default:
+				e.Respond(tools.Approval{Reason: "not now"})
+			}
+		case ToolReturned:
+			results[e.ToolUseID] = e
+		}
+	}
+	result, err := r.Wait()
+	require.NoError(t, err)
+
+	// Allowed and denied commands don't need approval
+	require.Equal(t, []string{"printf edit", "ls"}, requested)
+	require.Equal(t, "exit code: 0\nstdout:\nallowed\n", results["allowed"].Result)
+	require.True(t, results["denied"].IsError)
+	require.Contains(t, results["denied"].Result, "matches the denied pattern")
+	require.Equal(t, "the command was changed on approval to: printf edited\nexit code: 0\nstdout:\nedited\n", results["edited"].Result)
+	require.True(t, results["rejected"].IsError)
+	require.Contains(t, results["rejected"].Result, "ls was not approved: not now")
+
+	approvals := result.State.Approvals
+	require.Equal(t, 2, len(approvals))
+	require.Equal(t, "printf edit", approvals[0].Command)
+	require.Equal(t, "printf edited", approvals[0].EditedCommand)
+	require.True(t, approvals[0].Approved)
+	require.Equal(t, "ls", approvals[1].Command)
+	require.False(t, approvals[1].Approved)
+	require.Equal(t, "not now", approvals[1].Reason)
+}
+
+func TestExecuteDoesNotCountApprovalWaitsInMaxDuration(t *testing.T) {
+	def := loadDefinition(t, "testdata/commands.yaml")
+	def.Workspace = t.TempDir()
+	def.Agents[0].Budget = &BudgetDefinition{MaxDuration: 300 * time.Millisecond}
+
+	r, err := Execute(context.Background(), def, "commands")
+	require.NoError(t, err)
+
+	for event := range r.Events() {
+		if e, ok := event.(ApprovalRequested); ok {
+			time.Sleep(400 * time.Millisecond)
+			e.Respond(tools.Approval{Reason: "not now"})
+		}
+	}
+	result, err := r.Wait()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(result.State.Approvals))
+	require.Less(t, result.State.AgentUsage["Worker"].Duration, 300*time.Millisecond)
+}
+
+func TestWaitRejectsCommandsNeedingApproval(t *testing.T) {
+	def := loadDefinition(t, "testdata/commands.yaml")
+	def.Workspace = t.TempDir()
+
+	r, err := Execute(context.Background(), def, "commands")
+	require.NoError(t, err)
+
+	result, err := r.Wait()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(result.State.Approvals))
+	require.False(t, result.State.Approvals[0].Approved)
+	require.False(t, result.State.Approvals[1].Approved)
+}
+
+func TestExecuteRejectsInvalidToolPolicy(t *testing.T) {
+	def := loadDefinition(t, "testdata/tool_errors.yaml")
+	def.ToolPolicies = map[string]ToolPolicyDefinition{
+		"Explode": {OnError: "ignore"},
+	}
+
+	_, err := Execute(context.Background(), def, "tool-errors")
+	require.ErrorIs(t, err, InvalidToolPolicyErr)
+}
+
+func loadDefinition(t *testing.T, path string) *WorkflowDefinition {
+	workflowBytes, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	def := WorkflowDefinition{}
+	require.NoError(t, yaml.Unmarshal(workflowBytes, &def))
+
+	return &def
+}
+
+// drain returns the nodes that started and the final state of a run
+func drain(r *Run) ([]string, WorkflowState) {
+	var nodes []string
+	for event := range r.Events() {
+		if e, ok := event.(NodeStarted); ok {
+			nodes = append(nodes, e.Node)
+		}
+	}
+
+	result, _ := r.Wait()
+	return nodes, result.State
+}
+
+// drainFailed returns the nodes that started and the last event of a run
+// that is expected to fail
+func drainFailed(t *testing.T, r *Run) ([]string, RunFailed) {
+	var nodes []string
+	var failed *RunFailed
+	for event := range r.Events() {
+		switch e := event.(type) {
+		case NodeStarted:
+			nodes = append(nodes, e.Node)
+		case RunFailed:
+			failed = &e
+		}
+	}
+
+	require.NotNil(t, failed)
+	return nodes, *failed
+}
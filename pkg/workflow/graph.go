@@ -0,0 +1,87 @@
+package workflow
+
+import (
+	"clan/pkg/clan"
+	"fmt"
+	"strings"
+)
+
+// Mermaid describes the graph built for the workflow as a Mermaid flowchart.
+// Handovers decided by a next_agent_function are drawn as dotted edges to
+// every agent they could route to. Human agents are drawn as rounded nodes.
+func (d *WorkflowDefinition) Mermaid() string {
+	sb := strings.Builder{}
+	sb.WriteString("flowchart TD\n")
+	sb.WriteString(fmt.Sprintf("    Start((Start)) --> %s\n", d.StartAgent))
+
+	for _, agent := range d.Agents {
+		if agent.Type == AgentTypeHuman {
+			d.mermaidHuman(&sb, agent)
+			continue
+		}
+
+		toolsNodeName := fmt.Sprintf("%s_tools", agent.Name)
+		sb.WriteString(fmt.Sprintf("    %s --> %s\n", agent.Name, toolsNodeName))
+		sb.WriteString(fmt.Sprintf("    %s -->|continue| %s\n", toolsNodeName, agent.Name))
+
+		if agent.NextAgent != "" {
+			sb.WriteString(fmt.Sprintf("    %s -->|handover| %s\n", toolsNodeName, mermaidNode(agent.NextAgent)))
+			continue
+		}
+
+		if agent.NextAgentFunction != "" {
+			for _, other := range d.Agents {
+				if other.Name == agent.Name {
+					continue
+				}
+				sb.WriteString(fmt.Sprintf("    %s -.->|next_agent_function| %s\n", toolsNodeName, other.Name))
+			}
+			sb.WriteString(fmt.Sprintf("    %s -.->|next_agent_function| %s\n", toolsNodeName, mermaidNode(clan.End)))
+		}
+	}
+
+	return sb.String()
+}
+
+// mermaidHuman draws a human agent as a rounded node whose reply goes to
+// next_agent or back to the agents that can hand over to it
+func (d *WorkflowDefinition) mermaidHuman(sb *strings.Builder, agent AgentDefinition) {
+	sb.WriteString(fmt.Sprintf("    %s([%s])\n", agent.Name, agent.Name))
+	if agent.NextAgent != "" {
+		sb.WriteString(fmt.Sprintf("    %s -->|reply| %s\n", agent.Name, mermaidNode(agent.NextAgent)))
+		return
+	}
+
+	label := "reply"
+	if agent.NextAgentFunction != "" {
+		label = "next_agent_function"
+	}
+	for _, other := range d.Agents {
+		if other.Name != agent.Name {
+			sb.WriteString(fmt.Sprintf("    %s -.->|%s| %s\n", agent.Name, label, other.Name))
+		}
+	}
+	if agent.NextAgentFunction != "" {
+		sb.WriteString(fmt.Sprintf("    %s -.->|%s| %s\n", agent.Name, label, mermaidNode(clan.End)))
+	}
+}
+
+// nodeNames returns the names of the nodes of the graph built for the
+// workflow, every agent and the tools node of every model agent
+func (d *WorkflowDefinition) nodeNames() []string {
+	names := []string{}
+	for _, agent := range d.Agents {
+		names = append(names, agent.Name)
+		if agent.Type != AgentTypeHuman {
+			names = append(names, fmt.Sprintf("%s_tools", agent.Name))
+		}
+	}
+	return names
+}
+
+func mermaidNode(name string) string {
+	if name == clan.End {
+		return "End((End))"
+	}
+	return name
+}
@@ -0,0 +1,26 @@
+package workflow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMermaid(t *testing.T) {
+	def := loadDefinition(t, "testdata/software.yaml")
+
+	require.Equal(t, `flowchart TD
+    Start((Start)) --> Planner
+    Planner --> Planner_tools
+    Planner_tools -->|continue| Planner
+    Planner_tools -->|handover| Programmer
+    Programmer --> Programmer_tools
+    Programmer_tools -->|continue| Programmer
+    Programmer_tools -->|handover| Reviewer
+    Reviewer --> Reviewer_tools
+    Reviewer_tools -->|continue| Reviewer
+    Reviewer_tools -.->|next_agent_function| Planner
+    Reviewer_tools -.->|next_agent_function| Programmer
+    Reviewer_tools -.->|next_agent_function| End((End))
+`, def.Mermaid())
+}
@@ -0,0 +1,140 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+const (
+	// AgentTypeModel is the type of agents whose turns are generated by a
+	// model, the default
+	AgentTypeModel = "model"
+	// AgentTypeHuman is the type of agents whose turns are replies written by
+	// a person
+	AgentTypeHuman = "human"
+)
+
+// HumanInputRequiredError stops a run when a question was postponed. The
+// run can be resumed from its last checkpoint once the answer is known.
+type HumanInputRequiredError struct {
+	// Agent is the agent that asked
+	Agent string
+	// ToolUseID is the AskHuman call that asked, empty for questions handed
+	// over to human agents
+	ToolUseID string
+	Question  string
+}
+
+// PendingInput is a postponed question. It is answered by the first
+// InputRequested with the same agent, tool call and question, whose Pending
+// is set, when the run is resumed.
+type PendingInput struct {
+	Agent     string `json:"agent"`
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Question  string `json:"question"`
+}
+
+func (e *HumanInputRequiredError) Error() string {
+	return fmt.Sprintf("%s is waiting for an answer to: %s", e.Agent, e.Question)
+}
+
+type inputReply struct {
+	answer    string
+	postponed bool
+}
+
+// askHuman sends request and waits for its answer. A postponed question is
+// kept in the PendingInput of ws.
+func askHuman(ctx context.Context, events chan Event, request InputRequested, ws *WorkflowState) (string, error) {
+	reply := make(chan inputReply, 1)
+	pending := PendingInput{Agent: request.Agent, ToolUseID: request.ToolUseID, Question: request.Question}
+	request.Pending = ws.PendingInput != nil && *ws.PendingInput == pending
+	request.Summaries = slices.Clone(ws.Summaries)
+	request.reply = reply
+	defer waitForPerson(ctx)()
+	events <- request
+
+	select {
+	case r := <-reply:
+		if r.postponed {
+			ws.PendingInput = &pending
+			return "", &HumanInputRequiredError{Agent: request.Agent, ToolUseID: request.ToolUseID, Question: request.Question}
+		}
+		ws.PendingInput = nil
+		return r.answer, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// askHumanTool answers a call to AskHuman like executeTool
+func askHumanTool(ctx context.Context, events chan Event, agentName string, toolUseID string, input map[string]interface{}, ws *WorkflowState) (string, bool, error) {
+	question, ok := input["question"].(string)
+	if !ok || question == "" {
+		return "Error: missing parameter question", true, nil
+	}
+
+	answer, err := askHuman(ctx, events, InputRequested{Agent: agentName, ToolUseID: toolUseID, Question: question}, ws)
+	if err != nil {
+		return "", true, err
+	}
+
+	return answer, false, nil
+}
+
+// humanNode returns the node of a human agent. The question is the summary
+// of the agent that handed over, or the goal when the workflow starts with
+// the human agent. The reply is added to the summaries and the agent that
+// asked runs next unless next_agent or next_agent_function says otherwise.
+func humanNode(definition *WorkflowDefinition, agent *AgentDefinition, events chan Event) func(context.Context, *WorkflowState) (*WorkflowState, error) {
+	return func(ctx context.Context, ws *WorkflowState) (*WorkflowState, error) {
+		err := ws.checkBudgets(definition, agent, 0)
+		if err != nil {
+			return nil, err
+		}
+		events <- NodeStarted{Node: agent.Name, Agent: agent.Name}
+
+		question := definition.Goal
+		if len(ws.Summaries) > 0 {
+			question = ws.Summaries[len(ws.Summaries)-1].Summary
+		}
+		from := ws.CurrentAgent
+		if from == "" {
+			from = agent.Name
+		}
+
+		answer, err := askHuman(ctx, events, InputRequested{Agent: from, Human: agent.Name, Question: question}, ws)
+		if err != nil {
+			return nil, err
+		}
+
+		ws.Summaries = append(ws.Summaries, Summary{AgentName: agent.Name, Summary: answer})
+		ws.RequestedNextAgent = ws.CurrentAgent
+		ws.CurrentAgent = agent.Name
+		return ws, nil
+	}
+}
+
+// humanNextAgent routes the reply of a human agent
+func humanNextAgent(agent *AgentDefinition, events chan Event) func(*WorkflowState) (string, error) {
+	return func(ws *WorkflowState) (string, error) {
+		next := agent.NextAgent
+		if next == "" && agent.NextAgentFunction != "" {
+			var err error
+			next, err = executeNextAgentFn(agent.NextAgentFunction, ws)
+			if err != nil {
+				return "", err
+			}
+		}
+		if next == "" {
+			next = ws.RequestedNextAgent
+		}
+		if next == "" || next == agent.Name {
+			return "", fmt.Errorf("human agent %s has no agent to reply to, set next_agent", agent.Name)
+		}
+
+		events <- Handover{From: agent.Name, To: next, Summary: ws.Summaries[len(ws.Summaries)-1].Summary}
+		return next, nil
+	}
+}
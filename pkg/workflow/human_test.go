@@ -0,0 +1,193 @@
+package workflow
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteAsksHuman(t *testing.T) {
+	def := loadDefinition(t, "testdata/human.yaml")
+
+	r, err := Execute(context.Background(), def, "human")
+	require.NoError(t, err)
+
+	requests := []InputRequested{}
+	nodes := []string{}
+	handovers := []Handover{}
+	results := map[string]string{}
+	for event := range r.Events() {
+		switch e := event.(type) {
+		case NodeStarted:
+			nodes = append(nodes, e.Node)
+		case InputRequested:
+			requests = append(requests, e)
+			if e.Human == "" {
+				e.Answer("The world")
+			} else {
+				e.Answer("Looks good")
+			}
+		case Handover:
+			handovers = append(handovers, e)
+		case ToolReturned:
+			results[e.ToolUseID] = e.Result
+		}
+	}
+	result, err := r.Wait()
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"Writer", "Writer_tools", "Writer", "Writer_tools", "User", "Writer", "Writer_tools"}, nodes)
+
+	require.Equal(t, 2, len(requests))
+	require.Equal(t, "Writer", requests[0].Agent)
+	require.Equal(t, "", requests[0].Human)
+	require.Equal(t, "Who is the greeting for?", requests[0].Question)
+	require.Equal(t, "The world", results["ask"])
+
+	require.Equal(t, "Writer", requests[1].Agent)
+	require.Equal(t, "User", requests[1].Human)
+	require.Equal(t, "Greeting: Hello, world", requests[1].Question)
+	require.Equal(t, []Summary{{AgentName: "Writer", Summary: "Greeting: Hello, world"}}, requests[1].Summaries)
+
+	// The reply goes back to the agent that asked
+	require.Equal(t, Handover{From: "User", To: "Writer", Summary: "Looks good"}, handovers[1])
+	require.Equal(t, []Summary{
+		{AgentName: "Writer", Summary: "Greeting: Hello, world"},
+		{AgentName: "User", Summary: "Looks good"},
+		{AgentName: "Writer", Summary: "Greeting approved"},
+	}, result.State.Summaries)
+	writerHistory := result.State.AgentHistory["Writer"]
+	require.Contains(t, writerHistory[len(writerHistory)-3].Content[0].Content, "Looks good")
+}
+
+func TestPostponedQuestionsStopTheRun(t *testing.T) {
+	def := loadDefinition(t, "testdata/human.yaml")
+	def.Checkpoint = &CheckpointDefinition{Type: "sqlite3", ConnectionString: filepath.Join(t.TempDir(), "checkpoints.db")}
+
+	r, err := Execute(context.Background(), def, "human")
+	require.NoError(t, err)
+
+	// Questions are postponed when nobody reads the events
+	result, err := r.Wait()
+	require.Equal(t, StopAwaitingInput, result.Reason)
+	require.True(t, result.Reason.Resumable())
+	var inputErr *HumanInputRequiredError
+	require.ErrorAs(t, err, &inputErr)
+	require.Equal(t, "Writer", inputErr.Agent)
+	require.Equal(t, "Who is the greeting for?", inputErr.Question)
+
+	require.Equal(t, "ask", inputErr.ToolUseID)
+	require.Equal(t, &PendingInput{Agent: "Writer", ToolUseID: "ask", Question: "Who is the greeting for?"}, result.State.PendingInput)
+
+	// Resuming asks again, only the postponed question is pending
+	r, err = Resume(context.Background(), def, "human")
+	require.NoError(t, err)
+	questions := []string{}
+	pending := []bool{}
+	for event := range r.Events() {
+		if e, ok := event.(InputRequested); ok {
+			questions = append(questions, e.Question)
+			pending = append(pending, e.Pending)
+			e.Answer("ok")
+		}
+	}
+	result, err = r.Wait()
+	require.NoError(t, err)
+	require.Equal(t, StopCompleted, result.Reason)
+	require.Equal(t, []string{"Who is the greeting for?", "Greeting: Hello, world"}, questions)
+	require.Equal(t, []bool{true, false}, pending)
+	require.Nil(t, result.State.PendingInput)
+}
+
+func TestResumingAPostponedQuestionKeepsCompletedToolCalls(t *testing.T) {
+	def := loadDefinition(t, "testdata/human.yaml")
+	def.Checkpoint = &CheckpointDefinition{Type: "sqlite3", ConnectionString: filepath.Join(t.TempDir(), "checkpoints.db")}
+	def.Workspace = t.TempDir()
+	def.Agents[0].AvailableTools = append(def.Agents[0].AvailableTools, "Writer")
+	def.Agents[0].Fixture = filepath.Join(t.TempDir(), "fixture.yaml")
+	fixture := `agents:
+  Writer:
+  - content:
+    - type: tool_use
+      id: write
+      name: Writer
+      input:
+        filepath: log.txt
+        content: "written\n"
+        mode: append
+    - type: tool_use
+      id: ask
+      name: AskHuman
+      input:
+        question: Who is the greeting for?
+  - content:
+    - type: tool_use
+      name: NextAgentSelector
+      input:
+        summary: Done
+        next_agent: End
+`
+	require.NoError(t, os.WriteFile(def.Agents[0].Fixture, []byte(fixture), 0o644))
+
+	r, err := Execute(context.Background(), def, "human")
+	require.NoError(t, err)
+	_, err = r.Wait()
+	require.ErrorAs(t, err, new(*HumanInputRequiredError))
+
+	r, err = Resume(context.Background(), def, "human")
+	require.NoError(t, err)
+	called := []string{}
+	for event := range r.Events() {
+		switch e := event.(type) {
+		case ToolCalled:
+			called = append(called, e.ToolUseID)
+		case InputRequested:
+			e.Answer("The world")
+		}
+	}
+	result, err := r.Wait()
+	require.NoError(t, err)
+
+	// The Writer call is not repeated
+	require.Equal(t, []string{"ask", "toolu_mock_Writer_1_0"}, called)
+	logBytes, err := os.ReadFile(filepath.Join(def.Workspace, "log.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "written\n", string(logBytes))
+
+	results := []string{}
+	for _, m := range result.State.AgentHistory["Writer"] {
+		for _, c := range m.Content {
+			if c.ContentType == "tool_result" {
+				results = append(results, c.ToolUseId)
+			}
+		}
+	}
+	require.Equal(t, []string{"write", "ask", "toolu_mock_Writer_1_0"}, results)
+	require.Equal(t, 3, result.State.TotalUsage.ToolCalls)
+}
+
+func TestValidateHumanAgents(t *testing.T) {
+	def := loadDefinition(t, "testdata/human.yaml")
+	require.NoError(t, def.Validate())
+
+	def.StartAgent = "User"
+	def.Agents[1].AvailableTools = []string{"Reader"}
+	def.Agents[0].Type = "robot"
+	err := def.Validate()
+	require.EqualError(t, err, "agents[0].type: unknown agent type robot, expected model or human\nagents[1].available_tools: human agents cannot use tools\nagents[1]: a human start agent needs next_agent or next_agent_function to route its reply")
+}
+
+func TestMermaidWithHumanAgent(t *testing.T) {
+	def := loadDefinition(t, "testdata/human.yaml")
+
+	require.Equal(t, `flowchart TD
+    Start((Start)) --> Writer
+    Writer --> Writer_tools
+    Writer_tools -->|continue| Writer
+    User([User])
+    User -.->|reply| Writer
+`, def.Mermaid())
+}
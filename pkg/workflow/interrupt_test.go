@@ -0,0 +1,96 @@
+package workflow
+
+import (
+	"clan/pkg/clan"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterruptBeforeLetsTheStateBeEdited(t *testing.T) {
+	def := loadDefinition(t, "testdata/software.yaml")
+	def.Checkpoint = &CheckpointDefinition{Type: "sqlite3", ConnectionString: filepath.Join(t.TempDir(), "checkpoints.db")}
+	def.InterruptBefore = []string{"Programmer_tools"}
+
+	r, err := Execute(context.Background(), def, "software")
+	require.NoError(t, err)
+
+	nodes, failed := drainFailed(t, r)
+	require.Equal(t, []string{"Planner", "Planner_tools", "Planner", "Planner_tools", "Programmer"}, nodes)
+	require.Equal(t, StopInterrupted, failed.Reason)
+	require.True(t, failed.Reason.Resumable())
+	require.ErrorIs(t, failed.Err, clan.InterruptedErr)
+	require.EqualError(t, failed.Err, "interrupted before Programmer_tools")
+
+	snapshot, err := LastSnapshot(def, "software")
+	require.NoError(t, err)
+	require.Equal(t, "Programmer_tools", snapshot.Node)
+	require.Equal(t, 1, len(snapshot.State.Summaries))
+
+	snapshot.State.Summaries[0].Summary = "Write the programs in Go"
+	require.NoError(t, SaveSnapshot(def, "software", *snapshot))
+
+	// The resumed run starts with the edited state and runs the node it
+	// resumes from, until the node is reached again
+	r, err = Resume(context.Background(), def, "software")
+	require.NoError(t, err)
+	nodes, failed = drainFailed(t, r)
+	require.Equal(t, []string{"Programmer_tools", "Programmer"}, nodes)
+	require.Equal(t, StopInterrupted, failed.Reason)
+	require.Equal(t, "Write the programs in Go", failed.State.Summaries[0].Summary)
+
+	def.InterruptBefore = nil
+	r, err = Resume(context.Background(), def, "software")
+	require.NoError(t, err)
+	_, final := drain(r)
+	require.Equal(t, "Write the programs in Go", final.Summaries[0].Summary)
+	require.Equal(t, 3, len(final.Summaries))
+
+	// Completed runs cannot be changed
+	require.ErrorIs(t, SaveSnapshot(def, "software", *snapshot), WorkflowCompletedErr)
+}
+
+func TestInterruptAfterResumesFromTheNextNode(t *testing.T) {
+	def := loadDefinition(t, "testdata/software.yaml")
+	def.Checkpoint = &CheckpointDefinition{Type: "sqlite3", ConnectionString: filepath.Join(t.TempDir(), "checkpoints.db")}
+	def.InterruptAfter = []string{"Programmer_tools"}
+
+	r, err := Execute(context.Background(), def, "software")
+	require.NoError(t, err)
+
+	nodes, failed := drainFailed(t, r)
+	require.Equal(t, "Programmer_tools", nodes[len(nodes)-1])
+	require.EqualError(t, failed.Err, "interrupted after Programmer_tools")
+
+	snapshot, err := LastSnapshot(def, "software")
+	require.NoError(t, err)
+	require.Equal(t, "Programmer", snapshot.Node)
+
+	snapshot.Node = "Deployer"
+	require.ErrorIs(t, SaveSnapshot(def, "software", *snapshot), clan.NodeNotFoundErr)
+
+	// Changing the node hands the run over to another agent
+	snapshot.Node = "Reviewer"
+	require.NoError(t, SaveSnapshot(def, "software", *snapshot))
+
+	def.InterruptAfter = nil
+	r, err = Resume(context.Background(), def, "software")
+	require.NoError(t, err)
+	nodes, _ = drain(r)
+	require.Equal(t, "Reviewer", nodes[0])
+}
+
+func TestValidateInterrupts(t *testing.T) {
+	def := loadDefinition(t, "testdata/software.yaml")
+	def.InterruptBefore = []string{"Programmer_tools", "Deployer"}
+	def.InterruptAfter = []string{"Reviewer"}
+
+	err := def.Validate()
+	require.EqualError(t, err, "interrupt_before: a checkpoint is required to resume interrupted runs\ninterrupt_before[1]: unknown node Deployer, expected the name of an agent or of its tools node\ninterrupt_after: a checkpoint is required to resume interrupted runs")
+
+	def.Checkpoint = &CheckpointDefinition{Type: "sqlite3", ConnectionString: "checkpoints.db"}
+	def.InterruptBefore = []string{"Programmer_tools"}
+	require.NoError(t, def.Validate())
+}
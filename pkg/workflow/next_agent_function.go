@@ -1,7 +1,7 @@
 package workflow
 
 import (
-	"log"
+	"log/slog"
 
 	"go.starlark.net/starlark"
 	"go.starlark.net/syntax"
@@ -12,7 +12,7 @@ func executeNextAgentFn(funcDef string, state *WorkflowState) (string, error) {
 	thread := &starlark.Thread{Name: "my thread"}
 	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, "func.star", funcDef, nil)
 	if err != nil {
-		log.Printf("Unable to execute the Starlark function. Err is %s", err)
+		slog.Debug("Unable to execute the next_agent function", "err", err)
 		return "", err
 	}
 
@@ -23,7 +23,7 @@ func executeNextAgentFn(funcDef string, state *WorkflowState) (string, error) {
 	}, nil)
 
 	if err != nil {
-		log.Printf("Unable to run the Starlark function. Err is %s", err)
+		slog.Debug("Unable to run the next_agent function", "err", err)
 		return "", err
 	}
 
@@ -0,0 +1,101 @@
+package workflow
+
+import (
+	"clan/pkg/clan"
+	"clan/pkg/tools"
+	"context"
+	"errors"
+)
+
+// StopReason tells why a run stopped
+type StopReason string
+
+const (
+	// StopCompleted is the reason of runs that reached End
+	StopCompleted StopReason = "completed"
+	// StopTraversalDepth is the reason of runs that visited traversal_depth
+	// nodes without reaching End
+	StopTraversalDepth StopReason = "traversal_depth"
+	StopBudgetExceeded StopReason = "budget_exceeded"
+	StopCancelled      StopReason = "cancelled"
+	// StopAwaitingInput is the reason of runs stopped by a postponed
+	// question
+	StopAwaitingInput StopReason = "awaiting_input"
+	// StopInterrupted is the reason of runs stopped before or after a node
+	// listed in interrupt_before or interrupt_after
+	StopInterrupted StopReason = "interrupted"
+	// StopFailed is the reason of runs stopped by any other error
+	StopFailed StopReason = "failed"
+)
+
+// Resumable is true when the run stopped at a checkpoint it can be resumed
+// from once the cause has been addressed
+func (r StopReason) Resumable() bool {
+	return r == StopTraversalDepth || r == StopBudgetExceeded || r == StopCancelled || r == StopAwaitingInput || r == StopInterrupted
+}
+
+// stopReason classifies the error returned by the graph
+func stopReason(err error) StopReason {
+	var budgetErr *BudgetExceededError
+	var inputErr *HumanInputRequiredError
+	switch {
+	case err == nil:
+		return StopCompleted
+	case errors.Is(err, clan.TraversalDepthExceededErr):
+		return StopTraversalDepth
+	case errors.Is(err, clan.InterruptedErr):
+		return StopInterrupted
+	case errors.As(err, &budgetErr):
+		return StopBudgetExceeded
+	case errors.As(err, &inputErr):
+		return StopAwaitingInput
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return StopCancelled
+	default:
+		return StopFailed
+	}
+}
+
+// Result is the outcome of a run
+type Result struct {
+	WorkflowID string
+	State      WorkflowState
+	Reason     StopReason
+}
+
+// Run is a workflow running in the background, returned by Execute and
+// Resume
+type Run struct {
+	WorkflowID string
+
+	events chan Event
+	done   chan struct{}
+	result Result
+	err    error
+}
+
+// Events returns the channel of the events of the run. It is closed after a
+// RunCompleted or RunFailed event.
+func (r *Run) Events() <-chan Event {
+	return r.events
+}
+
+// Wait waits for the run to stop and returns its result and the error that
+// stopped it, nil when it reached End. Events that have not been read are
+// discarded, commands waiting for approval are rejected and questions are
+// postponed, so Wait is called once Events has been closed or instead of
+// reading them.
+func (r *Run) Wait() (Result, error) {
+	for event := range r.events {
+		// Nobody is there to approve commands or answer questions
+		switch e := event.(type) {
+		case ApprovalRequested:
+			e.Respond(tools.Approval{Reason: "nobody is reading the events of the run"})
+		case InputRequested:
+			e.Postpone()
+		}
+	}
+	<-r.done
+
+	return r.result, r.err
+}
@@ -0,0 +1,235 @@
+package workflow
+
+import (
+	"clan/pkg/llm"
+	"clan/pkg/tools"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+const schemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema is the subset of JSON Schema used to describe manifests
+type JSONSchema struct {
+	Schema      string `json:"$schema,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type,omitempty"`
+
+	Properties map[string]*JSONSchema `json:"properties,omitempty"`
+	Required   []string               `json:"required,omitempty"`
+	// AdditionalProperties is false for structs and the schema of the
+	// values for maps
+	AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema `json:"items,omitempty"`
+
+	Enum    []string      `json:"enum,omitempty"`
+	AnyOf   []*JSONSchema `json:"anyOf,omitempty"`
+	Pattern string        `json:"pattern,omitempty"`
+}
+
+// schemaRequired lists the fields that must be set, keyed by type name
+var schemaRequired = map[string][]string{
+	"WorkflowDefinition":    {"name", "start_agent", "agents"},
+	"AgentDefinition":       {"name"},
+	"StarlarkTool":          {"name", "function"},
+	"StarlarkToolParameter": {"name", "type"},
+	"CheckpointDefinition":  {"type", "connection_string"},
+	"CassetteDefinition":    {"mode", "path"},
+}
+
+// schemaDescriptions documents fields, keyed by type name and yaml name
+var schemaDescriptions = map[string]string{
+	"WorkflowDefinition.name":             "Name of the workflow",
+	"WorkflowDefinition.goal":             "Goal given to the agents",
+	"WorkflowDefinition.start_agent":      "Name of the agent that runs first",
+	"WorkflowDefinition.agents":           "Agents taking part in the workflow",
+	"WorkflowDefinition.tools":            "Custom tools implemented as Starlark functions",
+	"WorkflowDefinition.workspace":        "Directory the file and command tools are confined to, relative to the manifest",
+	"WorkflowDefinition.traversal_depth":  "Maximum number of nodes a run may visit",
+	"WorkflowDefinition.checkpoint":       "Where progress is stored so that runs can be resumed",
+	"WorkflowDefinition.cassette":         "Records or replays the traffic of every model",
+	"WorkflowDefinition.interrupt_before": "Nodes, agents or their tools nodes such as Deployer_tools, that stop the run before they run",
+	"WorkflowDefinition.interrupt_after":  "Nodes, agents or their tools nodes such as Deployer_tools, that stop the run after they have run",
+	"WorkflowDefinition.providers":        "Client settings for each provider, keyed by provider name",
+	"WorkflowDefinition.pricing":          "Model prices in US dollars per million tokens, keyed by model",
+	"WorkflowDefinition.budget":           "Limits for the whole run",
+	"WorkflowDefinition.tool_policies":    "How errors returned by each tool are handled, keyed by tool name",
+
+	"AgentDefinition.type":                "model, the default, or human for an agent played by the person running the workflow",
+	"AgentDefinition.system_prompt":       "Go template rendered with the workflow definition",
+	"AgentDefinition.purpose":             "What the agent does, shown to the other agents",
+	"AgentDefinition.provider":            "Model provider, anthropic when empty",
+	"AgentDefinition.base_url":            "Base URL of the provider's API",
+	"AgentDefinition.fixture":             "Responses served by the mock provider, relative to the manifest",
+	"AgentDefinition.next_agent":          "Agent to hand over to, or End",
+	"AgentDefinition.next_agent_function": "Starlark function next_agent(state) returning the agent to hand over to",
+	"AgentDefinition.available_tools":     "Tools the agent may call",
+	"AgentDefinition.workspace_access":    "Whether the agent's tools may change files in the workspace, read_write by default",
+	"AgentDefinition.commands":            "How the agent's CommandRunner runs commands",
+	"AgentDefinition.budget":              "Limits for the agent",
+
+	"CommandOptions.shell":            "Run commands with sh -c so that pipes, redirects, && and variables work",
+	"CommandOptions.timeout":          "Time after which a command is stopped when the call doesn't set one, 2m by default",
+	"CommandOptions.max_timeout":      "Longest timeout a call may ask for, 10m by default",
+	"CommandOptions.max_output_bytes": "Number of bytes kept of stdout and of stderr, the middle of longer output is dropped",
+	"CommandOptions.dir":              "Working directory relative to the workspace",
+	"CommandOptions.env":              "Environment variables added to the ones clan runs with",
+	"CommandOptions.allow":            "Programs commands may run, every program when allow and allow_patterns are empty",
+	"CommandOptions.allow_patterns":   "Regular expressions matching whole commands that may run",
+	"CommandOptions.deny_patterns":    "Regular expressions matching commands that never run, even when allowed",
+	"CommandOptions.approve":          "Ask before running every command, always, or the commands that are not allowed, unlisted",
+	"CommandOptions.sandbox":          "Run commands isolated from the host, Linux only",
+
+	"SandboxOptions.type":          "Sandbox backend, bwrap by default",
+	"SandboxOptions.network":       "Give commands access to the network, disabled by default",
+	"SandboxOptions.workspace":     "Mount the workspace as a throwaway copy-on-write view, copy, or let commands change it, write",
+	"SandboxOptions.cpu_seconds":   "CPU time each process of a command may use",
+	"SandboxOptions.memory_mb":     "Address space each process of a command may use, in megabytes",
+	"SandboxOptions.max_processes": "Number of processes a command may run",
+
+	"CheckpointDefinition.connection_string": "Database of the checkpoints, a sqlite3 file path is relative to the manifest",
+
+	"CassetteDefinition.path": "File the traffic is recorded to or replayed from, relative to the manifest",
+
+	"StarlarkTool.function": "Starlark source defining a function named after the tool in lower case",
+}
+
+// schemaOverrides refine the schema generated for a field, keyed by type
+// name and yaml name
+var schemaOverrides = map[string]func(*JSONSchema){
+	"AgentDefinition.available_tools": func(s *JSONSchema) {
+		builtins := []string{}
+		for _, t := range tools.AllTools(tools.Workspace{}, tools.CommandOptions{}, nil) {
+			builtins = append(builtins, t.Name())
+		}
+		// Tools defined in the manifest are also allowed
+		s.Items = &JSONSchema{AnyOf: []*JSONSchema{{Enum: builtins}, {Type: "string"}}}
+	},
+	"AgentDefinition.provider": func(s *JSONSchema) {
+		providers := llm.Providers()
+		slices.Sort(providers)
+		// Providers registered by applications are also allowed
+		s.AnyOf = []*JSONSchema{{Enum: providers}, {Type: "string"}}
+		s.Type = ""
+	},
+	"AgentDefinition.type": func(s *JSONSchema) {
+		s.Enum = []string{AgentTypeModel, AgentTypeHuman}
+	},
+	"AgentDefinition.workspace_access": func(s *JSONSchema) {
+		s.Enum = []string{WorkspaceReadWrite, WorkspaceReadOnly}
+	},
+	"CommandOptions.approve": func(s *JSONSchema) {
+		s.Enum = []string{tools.ApproveAlways, tools.ApproveUnlisted}
+	},
+	"SandboxOptions.type": func(s *JSONSchema) {
+		s.Enum = []string{tools.SandboxBubblewrap}
+	},
+	"SandboxOptions.workspace": func(s *JSONSchema) {
+		s.Enum = []string{tools.SandboxWorkspaceCopy, tools.SandboxWorkspaceWrite}
+	},
+	"CheckpointDefinition.type": func(s *JSONSchema) {
+		s.Enum = []string{"sqlite3"}
+	},
+	"CassetteDefinition.mode": func(s *JSONSchema) {
+		s.Enum = []string{llm.CassetteRecord, llm.CassetteReplay}
+	},
+	"StarlarkToolParameter.type": func(s *JSONSchema) {
+		s.Enum = starlarkParameterTypes
+	},
+	"ToolPolicyDefinition.on_error": func(s *JSONSchema) {
+		s.Enum = []string{ToolErrorReport, ToolErrorRetry, ToolErrorAbort}
+	},
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Schema describes the workflow manifest as a JSON Schema
+func Schema() *JSONSchema {
+	s := schemaFor(reflect.TypeOf(WorkflowDefinition{}))
+	s.Schema = schemaDraft
+	s.Title = "Clan workflow"
+	return s
+}
+
+// SchemaJSON returns the indented JSON of Schema
+func SchemaJSON() ([]byte, error) {
+	schemaBytes, err := json.MarshalIndent(Schema(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(schemaBytes, '\n'), nil
+}
+
+func schemaFor(t reflect.Type) *JSONSchema {
+	if t == durationType {
+		return &JSONSchema{
+			Type:        "string",
+			Description: "Duration such as 90s or 10m",
+			Pattern:     `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`,
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaFor(t.Elem())
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &JSONSchema{Type: "array", Items: schemaFor(t.Elem())}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: schemaFor(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	default:
+		return &JSONSchema{}
+	}
+}
+
+func structSchema(t reflect.Type) *JSONSchema {
+	s := &JSONSchema{
+		Type:                 "object",
+		Properties:           map[string]*JSONSchema{},
+		Required:             schemaRequired[t.Name()],
+		AdditionalProperties: false,
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		// Like yaml.v3, untagged fields use their lower cased name
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		key := t.Name() + "." + name
+		fs := schemaFor(field.Type)
+		if description, exists := schemaDescriptions[key]; exists {
+			fs.Description = description
+		}
+		if override, exists := schemaOverrides[key]; exists {
+			override(fs)
+		}
+		s.Properties[name] = fs
+	}
+
+	return s
+}
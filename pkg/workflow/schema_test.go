@@ -0,0 +1,71 @@
+package workflow
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// The published schema is regenerated with `clan schema > schema/workflow.schema.json`
+func TestSchemaIsPublished(t *testing.T) {
+	schemaBytes, err := SchemaJSON()
+	require.NoError(t, err)
+
+	published, err := os.ReadFile("../../schema/workflow.schema.json")
+	require.NoError(t, err)
+	require.Equal(t, string(published), string(schemaBytes))
+}
+
+func TestSchema(t *testing.T) {
+	s := Schema()
+	require.Equal(t, []string{"name", "start_agent", "agents"}, s.Required)
+
+	agent := s.Properties["agents"].Items
+	require.Equal(t, false, agent.AdditionalProperties)
+	require.Equal(t, "number", agent.Properties["temperature"].Type)
+	require.Contains(t, agent.Properties["available_tools"].Items.AnyOf[0].Enum, "CommandRunner")
+	require.Contains(t, agent.Properties["provider"].AnyOf[0].Enum, "openai")
+
+	require.Equal(t, []string{"sqlite3"}, s.Properties["checkpoint"].Properties["type"].Enum)
+	parameterType := s.Properties["tools"].Items.Properties["parameters"].Items.Properties["type"]
+	require.Equal(t, []string{"string", "integer", "boolean"}, parameterType.Enum)
+	require.Equal(t, "string", s.Properties["budget"].Properties["max_duration"].Type)
+	require.Equal(t, "number", s.Properties["pricing"].AdditionalProperties.(*JSONSchema).Properties["input"].Type)
+}
+
+func TestSchemaDescribesManifests(t *testing.T) {
+	for _, path := range []string{"testdata/software.yaml", "testdata/tool_errors.yaml", "../../samples/software.yaml", "../../samples/research_agent.yaml"} {
+		manifestBytes, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		root := yaml.Node{}
+		require.NoError(t, yaml.Unmarshal(manifestBytes, &root))
+		requireKnownProperties(t, Schema(), root.Content[0], path)
+	}
+}
+
+// requireKnownProperties checks that every key of node is described by s
+func requireKnownProperties(t *testing.T, s *JSONSchema, node *yaml.Node, path string) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			child := s
+			if s.Properties != nil {
+				child = s.Properties[key]
+				require.NotNil(t, child, "%s line %d: %s is not in the schema", path, node.Content[i].Line, key)
+			} else if additional, ok := s.AdditionalProperties.(*JSONSchema); ok {
+				child = additional
+			}
+			requireKnownProperties(t, child, node.Content[i+1], path)
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if s.Items != nil {
+				requireKnownProperties(t, s.Items, item, path)
+			}
+		}
+	}
+}
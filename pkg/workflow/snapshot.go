@@ -0,0 +1,102 @@
+package workflow
+
+import (
+	"clan/pkg/checkpointer"
+	"clan/pkg/clan"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// Snapshot is the state of a run at its last checkpoint and the node the run
+// continues from when it is resumed
+type Snapshot struct {
+	Node  string        `json:"node"`
+	State WorkflowState `json:"state"`
+}
+
+// LastSnapshot returns the snapshot of the last checkpoint of workflowID, for
+// example to review a run that was interrupted
+func LastSnapshot(definition *WorkflowDefinition, workflowID string) (*Snapshot, error) {
+	_, cp, err := lastCheckpoint(definition, workflowID)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := Snapshot{Node: cp.NodeName}
+	err = json.Unmarshal([]byte(cp.State), &snapshot.State)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+// SaveSnapshot stores snapshot as the last checkpoint of workflowID so that
+// Resume continues from its node with its state. Runs that have completed
+// cannot be changed.
+func SaveSnapshot(definition *WorkflowDefinition, workflowID string, snapshot Snapshot) error {
+	checkpointProvider, cp, err := lastCheckpoint(definition, workflowID)
+	if err != nil {
+		return err
+	}
+
+	if cp.NodeName == clan.End {
+		return WorkflowCompletedErr
+	}
+
+	if !slices.Contains(definition.nodeNames(), snapshot.Node) {
+		return fmt.Errorf("%w: %s", clan.NodeNotFoundErr, snapshot.Node)
+	}
+
+	stateBytes, err := json.Marshal(snapshot.State)
+	if err != nil {
+		return err
+	}
+
+	return checkpointProvider.Checkpoint(workflowID, checkpointer.Checkpoint{
+		NodeName:     snapshot.Node,
+		State:        string(stateBytes),
+		CurrentDepth: cp.CurrentDepth,
+	})
+}
+
+// saveState replaces the state of the last checkpoint of workflowID with ws,
+// for example to keep the progress of a node that stopped half way through
+func saveState(checkpointProvider checkpointer.Checkpointer, workflowID string, ws *WorkflowState) error {
+	cp, err := checkpointProvider.GetLastCheckpoint(workflowID)
+	if err != nil {
+		return err
+	}
+
+	stateBytes, err := json.Marshal(ws)
+	if err != nil {
+		return err
+	}
+
+	return checkpointProvider.Checkpoint(workflowID, checkpointer.Checkpoint{
+		NodeName:     cp.NodeName,
+		State:        string(stateBytes),
+		CurrentDepth: cp.CurrentDepth,
+	})
+}
+
+// lastCheckpoint opens the checkpointer of definition and reads the last
+// checkpoint of workflowID
+func lastCheckpoint(definition *WorkflowDefinition, workflowID string) (checkpointer.Checkpointer, *checkpointer.Checkpoint, error) {
+	if definition.Checkpoint == nil {
+		return nil, nil, NoCheckpointerDefinedErr
+	}
+
+	checkpointProvider, err := newCheckpointer(definition)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cp, err := checkpointProvider.GetLastCheckpoint(workflowID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to find a checkpoint for workflow %s: %w", workflowID, err)
+	}
+
+	return checkpointProvider, cp, nil
+}
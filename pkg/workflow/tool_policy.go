@@ -0,0 +1,99 @@
+package workflow
+
+import (
+	"clan/pkg/tools"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+const (
+	// ToolErrorReport returns the error to the model as a tool result so that
+	// the agent can correct itself
+	ToolErrorReport = "report"
+	// ToolErrorRetry executes the tool again before reporting the error
+	ToolErrorRetry = "retry"
+	// ToolErrorAbort stops the run
+	ToolErrorAbort = "abort"
+
+	DefaultToolMaxRetries = 2
+)
+
+var InvalidToolPolicyErr = errors.New("invalid tool policy")
+
+// permanentToolErrs are failures that running the tool again would repeat,
+// or that would ask a person to approve a command they have just rejected
+var permanentToolErrs = []error{tools.CommandDeniedErr, tools.CommandRejectedErr, tools.OutsideWorkspaceErr, tools.ReadOnlyWorkspaceErr}
+
+// ToolPolicyDefinition decides what happens when a tool returns an error.
+// OnError defaults to ToolErrorReport.
+type ToolPolicyDefinition struct {
+	OnError string `yaml:"on_error"`
+	// MaxRetries is used with ToolErrorRetry, zero uses DefaultToolMaxRetries
+	MaxRetries int `yaml:"max_retries"`
+}
+
+func (p ToolPolicyDefinition) validate(toolName string) error {
+	switch p.OnError {
+	case "", ToolErrorReport, ToolErrorRetry, ToolErrorAbort:
+	default:
+		return fmt.Errorf("%w for tool %s: unknown on_error %s", InvalidToolPolicyErr, toolName, p.OnError)
+	}
+
+	if p.MaxRetries < 0 {
+		return fmt.Errorf("%w for tool %s: max_retries must not be negative", InvalidToolPolicyErr, toolName)
+	}
+
+	return nil
+}
+
+// ToolError is returned when a tool fails under the ToolErrorAbort policy
+type ToolError struct {
+	AgentName string
+	ToolName  string
+	Err       error
+}
+
+func (e *ToolError) Error() string {
+	return fmt.Sprintf("tool %s called by agent %s failed: %s", e.ToolName, e.AgentName, e.Err)
+}
+
+func (e *ToolError) Unwrap() error {
+	return e.Err
+}
+
+// executeTool runs t according to policy. A non nil error is only returned
+// when the run should stop, otherwise failures are reported through isError
+// with the error text as the result.
+func executeTool(ctx context.Context, agentName string, t tools.Tool, input map[string]interface{}, policy ToolPolicyDefinition) (result string, isError bool, err error) {
+	attempts := 1
+	if policy.OnError == ToolErrorRetry {
+		attempts += DefaultToolMaxRetries
+		if policy.MaxRetries > 0 {
+			attempts = policy.MaxRetries + 1
+		}
+	}
+
+	for i := 0; i < attempts; i++ {
+		result, err = t.Execute(ctx, input)
+		if err == nil {
+			return result, false, nil
+		}
+
+		// A tool interrupted by cancellation stops the run
+		if ctx.Err() != nil {
+			return "", true, ctx.Err()
+		}
+
+		if slices.ContainsFunc(permanentToolErrs, func(target error) bool { return errors.Is(err, target) }) {
+			break
+		}
+	}
+
+	if policy.OnError == ToolErrorAbort {
+		return "", true, &ToolError{AgentName: agentName, ToolName: t.Name(), Err: err}
+	}
+
+	return fmt.Sprintf("Error: %s", err), true, nil
+}
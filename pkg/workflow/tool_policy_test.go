@@ -0,0 +1,88 @@
+package workflow
+
+import (
+	"clan/pkg/llm"
+	"clan/pkg/tools"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type flakyTool struct {
+	failures int
+	calls    int
+	err      error
+}
+
+func (f *flakyTool) Name() string {
+	return "Flaky"
+}
+
+func (f *flakyTool) Schema() llm.Tool {
+	return llm.Tool{Name: f.Name()}
+}
+
+func (f *flakyTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	f.calls++
+	if f.calls <= f.failures && f.err != nil {
+		return "", f.err
+	}
+	if f.calls <= f.failures {
+		return "", errors.New("temporary failure")
+	}
+	return "ok", nil
+}
+
+func TestExecuteToolReportsErrorsByDefault(t *testing.T) {
+	tool := &flakyTool{failures: 1}
+
+	result, isError, err := executeTool(context.Background(), "Worker", tool, nil, ToolPolicyDefinition{})
+	require.NoError(t, err)
+	require.True(t, isError)
+	require.Equal(t, "Error: temporary failure", result)
+	require.Equal(t, 1, tool.calls)
+}
+
+func TestExecuteToolRetries(t *testing.T) {
+	tool := &flakyTool{failures: 2}
+
+	result, isError, err := executeTool(context.Background(), "Worker", tool, nil, ToolPolicyDefinition{OnError: ToolErrorRetry})
+	require.NoError(t, err)
+	require.False(t, isError)
+	require.Equal(t, "ok", result)
+	require.Equal(t, 3, tool.calls)
+
+	tool = &flakyTool{failures: 5}
+	_, isError, err = executeTool(context.Background(), "Worker", tool, nil, ToolPolicyDefinition{OnError: ToolErrorRetry, MaxRetries: 1})
+	require.NoError(t, err)
+	require.True(t, isError)
+	require.Equal(t, 2, tool.calls)
+}
+
+func TestExecuteToolDoesNotRetryDenialsAndRejections(t *testing.T) {
+	for _, failure := range []error{
+		fmt.Errorf("%w: rm -rf src matches the denied pattern", tools.CommandDeniedErr),
+		fmt.Errorf("%w: ls was not approved", tools.CommandRejectedErr),
+		tools.ReadOnlyWorkspaceErr,
+	} {
+		tool := &flakyTool{failures: 5, err: failure}
+		result, isError, err := executeTool(context.Background(), "Worker", tool, nil, ToolPolicyDefinition{OnError: ToolErrorRetry})
+		require.NoError(t, err)
+		require.True(t, isError)
+		require.Equal(t, "Error: "+failure.Error(), result)
+		require.Equal(t, 1, tool.calls, failure.Error())
+	}
+}
+
+func TestExecuteToolAborts(t *testing.T) {
+	tool := &flakyTool{failures: 1}
+
+	_, _, err := executeTool(context.Background(), "Worker", tool, nil, ToolPolicyDefinition{OnError: ToolErrorAbort})
+	var toolErr *ToolError
+	require.ErrorAs(t, err, &toolErr)
+	require.Equal(t, "Flaky", toolErr.ToolName)
+	require.Equal(t, "Worker", toolErr.AgentName)
+}
@@ -0,0 +1,95 @@
+package workflow
+
+import (
+	"clan/pkg/llm"
+	"log/slog"
+	"time"
+)
+
+// UsageSummary accumulates the tokens consumed by model calls and their cost
+// in US dollars, the number of tools called and the time spent executing.
+// Cost only includes calls to models with a known price.
+type UsageSummary struct {
+	llm.Usage
+	Calls     int
+	Cost      float64
+	ToolCalls int
+	Duration  time.Duration
+}
+
+func (us *UsageSummary) add(usage llm.Usage, cost float64) {
+	us.Usage.Add(usage)
+	us.Calls++
+	us.Cost += cost
+}
+
+func (ws *WorkflowState) addUsage(agentName string, usage llm.Usage, cost float64) {
+	if ws.AgentUsage == nil {
+		ws.AgentUsage = make(map[string]UsageSummary)
+	}
+
+	summary := ws.AgentUsage[agentName]
+	summary.add(usage, cost)
+	ws.AgentUsage[agentName] = summary
+	ws.TotalUsage.add(usage, cost)
+}
+
+// model returns the model agent calls, the provider's default when the
+// agent does not set one
+func (d *WorkflowDefinition) model(agent *AgentDefinition) string {
+	if agent.Model != "" {
+		return agent.Model
+	}
+
+	provider := agent.Provider
+	if provider == "" {
+		provider = llm.DefaultProvider
+	}
+	return llm.DefaultModels[provider]
+}
+
+// pricer computes the cost of the responses of a run, warning once for
+// every model without a known price
+type pricer struct {
+	definition *WorkflowDefinition
+	unpriced   map[string]bool
+}
+
+// cost prices resp with the model that generated it, or the model agent
+// calls when the provider did not report it
+func (p *pricer) cost(agent *AgentDefinition, resp *llm.Response) float64 {
+	model := resp.Model
+	if model == "" {
+		model = p.definition.model(agent)
+	}
+
+	price, known := llm.PriceFor(model, p.definition.Pricing)
+	if !known && model != "" && resp.Usage.Total() > 0 && !p.unpriced[model] {
+		p.unpriced[model] = true
+		slog.Warn("No price is known for the model, its cost is counted as 0. Add it to pricing in the manifest", "agent", agent.Name, "model", model)
+	}
+
+	return price.Cost(resp.Usage)
+}
+
+func (ws *WorkflowState) addToolCall(agentName string) {
+	if ws.AgentUsage == nil {
+		ws.AgentUsage = make(map[string]UsageSummary)
+	}
+
+	summary := ws.AgentUsage[agentName]
+	summary.ToolCalls++
+	ws.AgentUsage[agentName] = summary
+	ws.TotalUsage.ToolCalls++
+}
+
+func (ws *WorkflowState) addDuration(agentName string, d time.Duration) {
+	if ws.AgentUsage == nil {
+		ws.AgentUsage = make(map[string]UsageSummary)
+	}
+
+	summary := ws.AgentUsage[agentName]
+	summary.Duration += d
+	ws.AgentUsage[agentName] = summary
+	ws.TotalUsage.Duration += d
+}
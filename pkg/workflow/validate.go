@@ -0,0 +1,500 @@
+package workflow
+
+import (
+	"clan/pkg/clan"
+	"clan/pkg/llm"
+	"clan/pkg/tools"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"gopkg.in/yaml.v3"
+)
+
+var InvalidDefinitionErr = errors.New("invalid workflow definition")
+
+// starlarkParameterTypes are the parameter types Starlark tools can receive
+var starlarkParameterTypes = []string{"string", "integer", "boolean"}
+
+// ValidationError is a problem found in a manifest. Path locates the value,
+// for example agents[1].next_agent, and Line and Column are its position in
+// the manifest or zero when the definition was not read by ParseDefinition.
+type ValidationError struct {
+	Path    string
+	Line    int
+	Column  int
+	Message string
+	Err     error
+}
+
+func (e ValidationError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.Path, e.Message)
+	}
+	return fmt.Sprintf("line %d, column %d: %s: %s", e.Line, e.Column, e.Path, e.Message)
+}
+
+func (e ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors holds every problem found in a manifest, in the order
+// they appear in it
+type ValidationErrors []ValidationError
+
+func (ve ValidationErrors) Error() string {
+	messages := []string{}
+	for _, e := range ve {
+		messages = append(messages, e.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (ve ValidationErrors) Is(target error) bool {
+	return target == InvalidDefinitionErr
+}
+
+func (ve ValidationErrors) Unwrap() []error {
+	errs := []error{}
+	for _, e := range ve {
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// ParseDefinition decodes a manifest and keeps the position of its values so
+// that Validate can report where problems are
+func ParseDefinition(data []byte) (*WorkflowDefinition, error) {
+	root := yaml.Node{}
+	err := yaml.Unmarshal(data, &root)
+	if err != nil {
+		return nil, err
+	}
+
+	def := WorkflowDefinition{}
+	if len(root.Content) == 0 {
+		return &def, nil
+	}
+
+	err = root.Decode(&def)
+	if err != nil {
+		return nil, err
+	}
+	def.node = root.Content[0]
+	def.source = strings.Split(string(data), "\n")
+
+	return &def, nil
+}
+
+// Validate checks the references between agents and tools, compiles every
+// Starlark function and system prompt template and checks the values that
+// would otherwise only fail once the workflow is running. All the problems
+// found are returned as ValidationErrors.
+func (d *WorkflowDefinition) Validate() error {
+	v := validator{definition: d}
+
+	agentNames := map[string]bool{}
+	if len(d.Agents) == 0 {
+		v.add(nil, "at least one agent is required", "agents")
+	}
+	for i, agent := range d.Agents {
+		switch {
+		case agent.Name == "":
+			v.add(nil, "name is required", "agents", i)
+		case agent.Name == clan.End:
+			v.add(nil, fmt.Sprintf("%s is reserved and cannot be used as an agent name", clan.End), "agents", i, "name")
+		case agentNames[agent.Name]:
+			v.add(nil, fmt.Sprintf("agent %s is defined more than once", agent.Name), "agents", i, "name")
+		}
+		agentNames[agent.Name] = true
+	}
+
+	v.agentNames = agentNames
+
+	if d.StartAgent == "" {
+		v.add(nil, "start_agent is required", "start_agent")
+	} else if !agentNames[d.StartAgent] {
+		v.add(nil, fmt.Sprintf("unknown agent %s", d.StartAgent), "start_agent")
+	}
+
+	if d.TraversalDepth < 0 {
+		v.add(nil, "traversal_depth must not be negative", "traversal_depth")
+	}
+
+	toolNames := map[string]bool{}
+	for _, t := range tools.AllTools(tools.Workspace{}, tools.CommandOptions{}, nil) {
+		toolNames[t.Name()] = true
+	}
+	for i, st := range d.Tools {
+		v.validateStarlarkTool(i, st, toolNames)
+		toolNames[st.Name] = true
+	}
+
+	providers := llm.Providers()
+	for i, agent := range d.Agents {
+		switch agent.Type {
+		case "", AgentTypeModel:
+		case AgentTypeHuman:
+			v.validateHumanAgent(i, agent)
+			continue
+		default:
+			v.add(nil, fmt.Sprintf("unknown agent type %s, expected %s or %s", agent.Type, AgentTypeModel, AgentTypeHuman), "agents", i, "type")
+		}
+
+		if agent.NextAgent != "" && agent.NextAgent != clan.End && !agentNames[agent.NextAgent] {
+			v.add(nil, fmt.Sprintf("unknown agent %s", agent.NextAgent), "agents", i, "next_agent")
+		}
+
+		if agent.NextAgentFunction != "" {
+			v.validateNextAgentFunction(i, agent.NextAgentFunction)
+		}
+
+		_, err := generateSystemPrompt(agent.SystemPrompt, d)
+		if err != nil {
+			v.add(err, fmt.Sprintf("invalid template: %s", err), "agents", i, "system_prompt")
+		}
+
+		for j, toolName := range agent.AvailableTools {
+			if !toolNames[toolName] {
+				v.add(nil, fmt.Sprintf("unknown tool %s", toolName), "agents", i, "available_tools", j)
+			}
+		}
+
+		provider := agent.Provider
+		if provider == "" {
+			provider = llm.DefaultProvider
+		}
+		if !slices.Contains(providers, provider) {
+			v.add(nil, fmt.Sprintf("unknown provider %s, expected one of %s", provider, strings.Join(providers, ", ")), "agents", i, "provider")
+		}
+		if provider == "mock" && agent.Fixture == "" {
+			v.add(nil, "a fixture is required for the mock provider", "agents", i, "provider")
+		}
+
+		if agent.WorkspaceAccess != "" && agent.WorkspaceAccess != WorkspaceReadWrite && agent.WorkspaceAccess != WorkspaceReadOnly {
+			v.add(nil, fmt.Sprintf("unknown workspace access %s, expected %s or %s", agent.WorkspaceAccess, WorkspaceReadWrite, WorkspaceReadOnly), "agents", i, "workspace_access")
+		}
+
+		v.validateCommands(agent.Commands, "agents", i, "commands")
+		v.validateBudget(agent.Budget, "agents", i, "budget")
+	}
+
+	v.validateInterrupts(d.InterruptBefore, "interrupt_before")
+	v.validateInterrupts(d.InterruptAfter, "interrupt_after")
+
+	if d.Checkpoint != nil && d.Checkpoint.Type != "sqlite3" {
+		v.add(nil, fmt.Sprintf("unknown checkpoint type %s, expected sqlite3", d.Checkpoint.Type), "checkpoint", "type")
+	}
+
+	if d.Cassette != nil {
+		if d.Cassette.Mode != llm.CassetteRecord && d.Cassette.Mode != llm.CassetteReplay {
+			v.add(nil, fmt.Sprintf("unknown cassette mode %s, expected record or replay", d.Cassette.Mode), "cassette", "mode")
+		}
+		if d.Cassette.Path == "" {
+			v.add(nil, "path is required", "cassette")
+		}
+	}
+
+	for _, toolName := range sortedKeys(d.ToolPolicies) {
+		if !toolNames[toolName] {
+			v.add(nil, fmt.Sprintf("unknown tool %s", toolName), "tool_policies", toolName)
+		}
+		err := d.ToolPolicies[toolName].validate(toolName)
+		if err != nil {
+			v.add(err, err.Error(), "tool_policies", toolName)
+		}
+	}
+
+	v.validateBudget(d.Budget, "budget")
+	v.validatePricing()
+
+	if len(v.errs) == 0 {
+		return nil
+	}
+
+	slices.SortStableFunc(v.errs, func(a, b ValidationError) int {
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+	return v.errs
+}
+
+type validator struct {
+	definition *WorkflowDefinition
+	agentNames map[string]bool
+	errs       ValidationErrors
+}
+
+// add records a problem with the value at path, which is made of mapping
+// keys and sequence indexes
+func (v *validator) add(err error, message string, path ...interface{}) {
+	line, column := v.position(path...)
+	v.addAt(err, message, line, column, path...)
+}
+
+func (v *validator) addAt(err error, message string, line int, column int, path ...interface{}) {
+	v.errs = append(v.errs, ValidationError{
+		Path:    formatPath(path),
+		Line:    line,
+		Column:  column,
+		Message: message,
+		Err:     err,
+	})
+}
+
+func (v *validator) validateStarlarkTool(i int, st tools.StarlarkTool, toolNames map[string]bool) {
+	if st.Name == "" {
+		v.add(nil, "name is required", "tools", i)
+		return
+	}
+
+	if toolNames[st.Name] {
+		v.add(nil, fmt.Sprintf("tool %s is defined more than once", st.Name), "tools", i, "name")
+	}
+
+	for j, p := range st.Parameters {
+		if !slices.Contains(starlarkParameterTypes, p.Type) {
+			v.add(nil, fmt.Sprintf("unknown parameter type %s, expected one of %s", p.Type, strings.Join(starlarkParameterTypes, ", ")), "tools", i, "parameters", j, "type")
+		}
+	}
+
+	err := st.Compile()
+	if err != nil {
+		v.addStarlarkErr(err, "tools", i, "function")
+	}
+}
+
+// validateHumanAgent checks the settings used by human agents, which don't
+// call models or tools
+func (v *validator) validateHumanAgent(i int, agent AgentDefinition) {
+	if agent.NextAgent != "" && agent.NextAgent != clan.End && !v.agentNames[agent.NextAgent] {
+		v.add(nil, fmt.Sprintf("unknown agent %s", agent.NextAgent), "agents", i, "next_agent")
+	}
+	if agent.NextAgentFunction != "" {
+		v.validateNextAgentFunction(i, agent.NextAgentFunction)
+	}
+	if len(agent.AvailableTools) > 0 {
+		v.add(nil, "human agents cannot use tools", "agents", i, "available_tools")
+	}
+	if agent.Name == v.definition.StartAgent && agent.NextAgent == "" && agent.NextAgentFunction == "" {
+		v.add(nil, "a human start agent needs next_agent or next_agent_function to route its reply", "agents", i)
+	}
+}
+
+// validateInterrupts checks that the nodes to interrupt exist and that the
+// run can be resumed once it has been interrupted
+func (v *validator) validateInterrupts(nodes []string, key string) {
+	if len(nodes) > 0 && v.definition.Checkpoint == nil {
+		v.add(nil, "a checkpoint is required to resume interrupted runs", key)
+	}
+
+	nodeNames := v.definition.nodeNames()
+	for i, node := range nodes {
+		if !slices.Contains(nodeNames, node) {
+			v.add(nil, fmt.Sprintf("unknown node %s, expected the name of an agent or of its tools node", node), key, i)
+		}
+	}
+}
+
+// validatePricing checks that the cost of every model agent can be counted
+// when the workflow or an agent has a max_cost budget
+func (v *validator) validatePricing() {
+	d := v.definition
+	maxCost := d.Budget != nil && d.Budget.MaxCost > 0
+	for _, agent := range d.Agents {
+		maxCost = maxCost || agent.Budget != nil && agent.Budget.MaxCost > 0
+	}
+	if !maxCost {
+		return
+	}
+
+	for i, agent := range d.Agents {
+		if agent.Type == AgentTypeHuman {
+			continue
+		}
+
+		model := d.model(&agent)
+		switch {
+		case model == "":
+			v.add(nil, "max_cost needs the price of the agent's model, set model and add it to pricing", "agents", i)
+		default:
+			if _, known := llm.PriceFor(model, d.Pricing); !known {
+				v.add(nil, fmt.Sprintf("no price is known for model %s, add it to pricing so that max_cost can be enforced", model), "agents", i)
+			}
+		}
+	}
+}
+
+func (v *validator) validateNextAgentFunction(i int, function string) {
+	f, _, err := starlark.SourceProgramOptions(&syntax.FileOptions{}, "func.star", function, func(string) bool { return false })
+	if err != nil {
+		v.addStarlarkErr(err, "agents", i, "next_agent_function")
+		return
+	}
+
+	for _, stmt := range f.Stmts {
+		if d, ok := stmt.(*syntax.DefStmt); ok && d.Name.Name == "next_agent" {
+			return
+		}
+	}
+	v.add(nil, "expected function next_agent not found", "agents", i, "next_agent_function")
+}
+
+// addStarlarkErr reports a Starlark error at its position within the
+// manifest when the function is written as a block scalar
+func (v *validator) addStarlarkErr(err error, path ...interface{}) {
+	line, column := v.position(path...)
+	node := v.node(path...)
+
+	var pos syntax.Position
+	var syntaxErr syntax.Error
+	var resolveErrs resolve.ErrorList
+	switch {
+	case errors.As(err, &syntaxErr):
+		pos = syntaxErr.Pos
+	case errors.As(err, &resolveErrs) && len(resolveErrs) > 0:
+		pos = resolveErrs[0].Pos
+	}
+
+	if node != nil && pos.Line > 0 && (node.Style == yaml.LiteralStyle || node.Style == yaml.FoldedStyle) {
+		line = node.Line + int(pos.Line)
+		column = int(pos.Col)
+		// Block scalars are indented by the amount of their first line
+		if node.Line < len(v.definition.source) {
+			firstLine := v.definition.source[node.Line]
+			column += len(firstLine) - len(strings.TrimLeft(firstLine, " "))
+		}
+	}
+
+	v.addAt(err, fmt.Sprintf("invalid Starlark: %s", err), line, column, path...)
+}
+
+func (v *validator) validateBudget(b *BudgetDefinition, path ...interface{}) {
+	if b == nil {
+		return
+	}
+
+	if b.MaxTokens < 0 || b.MaxCost < 0 || b.MaxDuration < 0 || b.MaxToolCalls < 0 {
+		v.add(nil, "budget limits must not be negative", path...)
+	}
+}
+
+func (v *validator) validateCommands(c *tools.CommandOptions, path ...interface{}) {
+	if c == nil {
+		return
+	}
+
+	if c.Timeout < 0 || c.MaxTimeout < 0 || c.MaxOutputBytes < 0 {
+		v.add(nil, "command limits must not be negative", path...)
+	}
+	if c.MaxTimeout > 0 && c.Timeout > c.MaxTimeout {
+		v.add(nil, "timeout must not be longer than max_timeout", append(path, "timeout")...)
+	}
+	if filepath.IsAbs(c.Dir) {
+		v.add(nil, "dir must be relative to the workspace", append(path, "dir")...)
+	}
+
+	for _, field := range []struct {
+		name     string
+		patterns []string
+	}{{"allow_patterns", c.AllowPatterns}, {"deny_patterns", c.DenyPatterns}} {
+		for i, pattern := range field.patterns {
+			_, err := regexp.Compile(pattern)
+			if err != nil {
+				v.add(err, fmt.Sprintf("invalid pattern: %s", err), append(path, field.name, i)...)
+			}
+		}
+	}
+
+	if c.Approve != "" && c.Approve != tools.ApproveAlways && c.Approve != tools.ApproveUnlisted {
+		v.add(nil, fmt.Sprintf("unknown approve mode %s, expected %s or %s", c.Approve, tools.ApproveAlways, tools.ApproveUnlisted), append(path, "approve")...)
+	}
+
+	if c.Sandbox != nil {
+		sandboxPath := append(path, "sandbox")
+		if c.Sandbox.Type != "" && c.Sandbox.Type != tools.SandboxBubblewrap {
+			v.add(nil, fmt.Sprintf("unknown sandbox type %s, expected %s", c.Sandbox.Type, tools.SandboxBubblewrap), append(sandboxPath, "type")...)
+		}
+		if c.Sandbox.Workspace != "" && c.Sandbox.Workspace != tools.SandboxWorkspaceCopy && c.Sandbox.Workspace != tools.SandboxWorkspaceWrite {
+			v.add(nil, fmt.Sprintf("unknown sandbox workspace %s, expected %s or %s", c.Sandbox.Workspace, tools.SandboxWorkspaceCopy, tools.SandboxWorkspaceWrite), append(sandboxPath, "workspace")...)
+		}
+		if c.Sandbox.CPUSeconds < 0 || c.Sandbox.MemoryMB < 0 || c.Sandbox.MaxProcesses < 0 {
+			v.add(nil, "sandbox limits must not be negative", sandboxPath...)
+		}
+	}
+}
+
+func (v *validator) position(path ...interface{}) (int, int) {
+	node := v.node(path...)
+	if node == nil {
+		return 0, 0
+	}
+	return node.Line, node.Column
+}
+
+// node returns the node at path or the deepest node found along it
+func (v *validator) node(path ...interface{}) *yaml.Node {
+	node := v.definition.node
+	if node == nil {
+		return nil
+	}
+
+	for _, p := range path {
+		var next *yaml.Node
+		switch key := p.(type) {
+		case string:
+			if node.Kind != yaml.MappingNode {
+				return node
+			}
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == key {
+					next = node.Content[i+1]
+				}
+			}
+		case int:
+			if node.Kind == yaml.SequenceNode && key < len(node.Content) {
+				next = node.Content[key]
+			}
+		}
+
+		if next == nil {
+			return node
+		}
+		node = next
+	}
+
+	return node
+}
+
+func formatPath(path []interface{}) string {
+	sb := strings.Builder{}
+	for _, p := range path {
+		switch key := p.(type) {
+		case string:
+			if sb.Len() > 0 {
+				sb.WriteString(".")
+			}
+			sb.WriteString(key)
+		case int:
+			sb.WriteString(fmt.Sprintf("[%d]", key))
+		}
+	}
+	return sb.String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
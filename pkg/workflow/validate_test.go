@@ -0,0 +1,145 @@
+package workflow
+
+import (
+	"clan/pkg/llm"
+	"clan/pkg/tools"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateValidDefinition(t *testing.T) {
+	for _, path := range []string{"testdata/software.yaml", "testdata/tool_errors.yaml", "testdata/commands.yaml", "../../samples/software.yaml", "../../samples/research_agent.yaml"} {
+		def := parseDefinition(t, path)
+		require.NoError(t, def.Validate(), path)
+	}
+}
+
+func TestValidateReportsPositions(t *testing.T) {
+	def := parseDefinition(t, "testdata/invalid.yaml")
+
+	err := def.Validate()
+	require.ErrorIs(t, err, InvalidDefinitionErr)
+
+	var errs ValidationErrors
+	require.ErrorAs(t, err, &errs)
+
+	type problem struct {
+		Path string
+		Line int
+	}
+	problems := []problem{}
+	for _, e := range errs {
+		problems = append(problems, problem{Path: e.Path, Line: e.Line})
+	}
+
+	require.Equal(t, []problem{
+		{Path: "start_agent", Line: 3},
+		{Path: "agents[0].system_prompt", Line: 6},
+		{Path: "agents[0].next_agent", Line: 10},
+		{Path: "agents[0].available_tools[1]", Line: 13},
+		{Path: "agents[1].next_agent_function", Line: 20},
+		{Path: "tools[0].parameters[0].type", Line: 28},
+		{Path: "tools[1].function", Line: 36},
+		{Path: "tools[2].function", Line: 39},
+		{Path: "checkpoint.type", Line: 43},
+	}, problems)
+
+	require.Equal(t, "line 3, column 14: start_agent: unknown agent Planer", errs[0].Error())
+
+	// Starlark errors point inside the function
+	require.Equal(t, 14, errs[6].Column)
+	require.Contains(t, errs[6].Message, "undefined: undefined_name")
+}
+
+func TestValidateWithoutPositions(t *testing.T) {
+	def := loadDefinition(t, "testdata/software.yaml")
+	def.StartAgent = "Nobody"
+
+	err := def.Validate()
+	require.EqualError(t, err, "start_agent: unknown agent Nobody")
+}
+
+func TestValidateWorkspaceAccess(t *testing.T) {
+	def := loadDefinition(t, "testdata/software.yaml")
+	def.Agents[0].WorkspaceAccess = WorkspaceReadOnly
+	require.NoError(t, def.Validate())
+	require.True(t, def.workspace(&def.Agents[0]).ReadOnly)
+	require.False(t, def.workspace(&def.Agents[1]).ReadOnly)
+
+	def.Agents[1].WorkspaceAccess = "write_only"
+	err := def.Validate()
+	require.EqualError(t, err, "agents[1].workspace_access: unknown workspace access write_only, expected read_write or read_only")
+}
+
+func TestValidatePricing(t *testing.T) {
+	def := loadDefinition(t, "testdata/software.yaml")
+	def.Budget = &BudgetDefinition{MaxCost: 1}
+	def.Agents[0].Provider = "anthropic"
+	require.NoError(t, def.Validate())
+	require.Equal(t, "claude-3-haiku-20240307", def.model(&def.Agents[0]))
+
+	def.Agents[1].Model = "claude-9"
+	err := def.Validate()
+	require.EqualError(t, err, "agents[1]: no price is known for model claude-9, add it to pricing so that max_cost can be enforced")
+
+	def.Pricing = map[string]llm.ModelPrice{"claude-9": {Input: 1, Output: 2}}
+	require.NoError(t, def.Validate())
+}
+
+func TestPricerUsesTheModelOfTheResponse(t *testing.T) {
+	def := loadDefinition(t, "testdata/software.yaml")
+	prices := &pricer{definition: def, unpriced: map[string]bool{}}
+	usage := llm.Usage{InputTokens: 1_000_000}
+
+	// Agents without a model are priced like the provider's default
+	agent := AgentDefinition{Name: "Planner", Provider: "anthropic"}
+	require.InDelta(t, 0.25, prices.cost(&agent, &llm.Response{Usage: usage}), 0.000001)
+	require.InDelta(t, 3, prices.cost(&agent, &llm.Response{Usage: usage, Model: "claude-3-5-sonnet-20240620"}), 0.000001)
+	require.Equal(t, float64(0), prices.cost(&agent, &llm.Response{Usage: usage, Model: "claude-9"}))
+	require.True(t, prices.unpriced["claude-9"])
+}
+
+func TestValidateCommands(t *testing.T) {
+	def := loadDefinition(t, "testdata/software.yaml")
+	def.Agents[0].Commands = &tools.CommandOptions{Shell: true, Timeout: time.Minute, Dir: "src"}
+	require.NoError(t, def.Validate())
+	require.True(t, def.commands(&def.Agents[0]).Shell)
+	require.Equal(t, tools.CommandOptions{}, def.commands(&def.Agents[1]))
+
+	def.Agents[0].Commands = &tools.CommandOptions{Timeout: time.Hour, MaxTimeout: time.Minute, MaxOutputBytes: -1, Dir: "/tmp"}
+	err := def.Validate()
+	require.EqualError(t, err, strings.Join([]string{
+		"agents[0].commands: command limits must not be negative",
+		"agents[0].commands.timeout: timeout must not be longer than max_timeout",
+		"agents[0].commands.dir: dir must be relative to the workspace",
+	}, "\n"))
+
+	def.Agents[0].Commands = &tools.CommandOptions{DenyPatterns: []string{"rm (-rf"}, Approve: "sometimes"}
+	err = def.Validate()
+	require.EqualError(t, err, strings.Join([]string{
+		"agents[0].commands.deny_patterns[0]: invalid pattern: error parsing regexp: missing closing ): `rm (-rf`",
+		"agents[0].commands.approve: unknown approve mode sometimes, expected always or unlisted",
+	}, "\n"))
+
+	def.Agents[0].Commands = &tools.CommandOptions{Sandbox: &tools.SandboxOptions{Type: "docker", Workspace: "overlay", MemoryMB: -1}}
+	err = def.Validate()
+	require.EqualError(t, err, strings.Join([]string{
+		"agents[0].commands.sandbox.type: unknown sandbox type docker, expected bwrap",
+		"agents[0].commands.sandbox.workspace: unknown sandbox workspace overlay, expected copy or write",
+		"agents[0].commands.sandbox: sandbox limits must not be negative",
+	}, "\n"))
+}
+
+func parseDefinition(t *testing.T, path string) *WorkflowDefinition {
+	workflowBytes, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	def, err := ParseDefinition(workflowBytes)
+	require.NoError(t, err)
+
+	return def
+}
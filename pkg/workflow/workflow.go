@@ -1,31 +1,104 @@
 package workflow
 
-import "clan/pkg/tools"
+import (
+	"clan/pkg/llm"
+	"clan/pkg/tools"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
 
 type WorkflowDefinition struct {
-	Name           string                `yaml:"name"`
-	Type           string                `yaml:"type"`
-	Goal           string                `yaml:"goal"`
-	Description    string                `yaml:"description"`
-	StartAgent     string                `yaml:"start_agent"`
-	Agents         []AgentDefinition     `yaml:"agents"`
-	Tools          []tools.StarlarkTool  `yaml:"tools"`
+	Name        string               `yaml:"name"`
+	Type        string               `yaml:"type"`
+	Goal        string               `yaml:"goal"`
+	Description string               `yaml:"description"`
+	StartAgent  string               `yaml:"start_agent"`
+	Agents      []AgentDefinition    `yaml:"agents"`
+	Tools       []tools.StarlarkTool `yaml:"tools"`
+	// Workspace is the directory the file and command tools are confined
+	// to, tools.DefaultWorkspace when empty
+	Workspace      string                `yaml:"workspace"`
 	TraversalDepth int                   `yaml:"traversal_depth"`
 	Checkpoint     *CheckpointDefinition `yaml:"checkpoint"`
+	Cassette       *CassetteDefinition   `yaml:"cassette"`
+	// InterruptBefore and InterruptAfter are the nodes, agents or their
+	// tools nodes, that stop the run so that its state can be reviewed
+	InterruptBefore []string `yaml:"interrupt_before"`
+	InterruptAfter  []string `yaml:"interrupt_after"`
+	// Providers configures the clients shared by the agents using each
+	// provider, keyed by provider name
+	Providers map[string]ProviderDefinition `yaml:"providers"`
+	// Pricing adds or overrides model prices in US dollars per million tokens
+	Pricing map[string]llm.ModelPrice `yaml:"pricing"`
+	Budget  *BudgetDefinition         `yaml:"budget"`
+	// ToolPolicies decides how errors returned by each tool are handled,
+	// keyed by tool name
+	ToolPolicies map[string]ToolPolicyDefinition `yaml:"tool_policies"`
+
+	// node and source are the manifest the definition was parsed from, used
+	// to report the position of validation errors
+	node   *yaml.Node
+	source []string
 }
 
 type AgentDefinition struct {
 	Name              string   `yaml:"name"`
+	Type              string   `yaml:"type"`
 	SystemPrompt      string   `yaml:"system_prompt"`
 	Purpose           string   `yaml:"purpose"`
-	Temperature       float32  `yaml:"temperature"`
+	Temperature       *float32 `yaml:"temperature"`
+	TopP              *float32 `yaml:"top_p"`
+	TopK              *int     `yaml:"top_k"`
+	MaxTokens         int      `yaml:"max_tokens"`
+	StopSequences     []string `yaml:"stop_sequences"`
+	Provider          string   `yaml:"provider"`
+	BaseURL           string   `yaml:"base_url"`
+	Fixture           string   `yaml:"fixture"`
 	Model             string   `yaml:"model"`
 	NextAgent         string   `yaml:"next_agent"`
 	NextAgentFunction string   `yaml:"next_agent_function"`
 	AvailableTools    []string `yaml:"available_tools"`
+	// WorkspaceAccess is WorkspaceReadWrite, the default, or
+	// WorkspaceReadOnly to stop the agent's tools from changing files
+	WorkspaceAccess string `yaml:"workspace_access"`
+	// Commands configures the agent's CommandRunner
+	Commands *tools.CommandOptions `yaml:"commands"`
+
+	Budget *BudgetDefinition `yaml:"budget"`
+}
+
+const (
+	WorkspaceReadWrite = "read_write"
+	WorkspaceReadOnly  = "read_only"
+)
+
+// workspace returns the workspace the tools of agent operate in
+func (d *WorkflowDefinition) workspace(agent *AgentDefinition) tools.Workspace {
+	return tools.Workspace{Root: d.Workspace, ReadOnly: agent.WorkspaceAccess == WorkspaceReadOnly}
+}
+
+// commands returns the options of the CommandRunner of agent
+func (d *WorkflowDefinition) commands(agent *AgentDefinition) tools.CommandOptions {
+	if agent.Commands == nil {
+		return tools.CommandOptions{}
+	}
+	return *agent.Commands
 }
 
 type CheckpointDefinition struct {
 	Type             string `yaml:"type"`
 	ConnectionString string `yaml:"connection_string"`
 }
+
+type CassetteDefinition struct {
+	Mode string `yaml:"mode"`
+	Path string `yaml:"path"`
+}
+
+type ProviderDefinition struct {
+	Timeout           time.Duration `yaml:"timeout"`
+	MaxRetries        int           `yaml:"max_retries"`
+	MaxConcurrency    int           `yaml:"max_concurrency"`
+	RequestsPerMinute int           `yaml:"requests_per_minute"`
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"clan/pkg/tools"
+	"clan/pkg/workflow"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+var (
+	stdinOnce  sync.Once
+	stdinLines chan string
+)
+
+// readLine returns the next line of stdin, or false when stdin is closed or
+// ctx is done. Lines are read in the background so that an interrupted run
+// doesn't wait for an answer.
+func readLine(ctx context.Context) (string, bool) {
+	stdinOnce.Do(func() {
+		stdinLines = make(chan string)
+		go func() {
+			defer close(stdinLines)
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				stdinLines <- scanner.Text()
+			}
+		}()
+	})
+
+	select {
+	case line, ok := <-stdinLines:
+		return strings.TrimSpace(line), ok
+	case <-ctx.Done():
+		return "", false
+	}
+}
+
+// approve shows the command of e on out and asks whether it may run, be
+// edited first or not run at all
+func approve(ctx context.Context, e workflow.ApprovalRequested, out io.Writer) tools.Approval {
+	fmt.Fprintf(out, color.RedString("APPROVAL NEEDED: ")+"%s wants to run\n  %s\n", e.Agent, e.Command)
+	for {
+		fmt.Fprint(out, "Run it? [y]es, [n]o, [e]dit: ")
+		answer, ok := readLine(ctx)
+		if !ok {
+			fmt.Fprintln(out)
+			return tools.Approval{Reason: "no answer was given"}
+		}
+
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			return tools.Approval{Approved: true}
+		case "n", "no":
+			fmt.Fprint(out, "Reason, passed to the agent (optional): ")
+			reason, _ := readLine(ctx)
+			return tools.Approval{Reason: reason}
+		case "e", "edit":
+			fmt.Fprint(out, "Command: ")
+			command, ok := readLine(ctx)
+			if ok && command != "" {
+				return tools.Approval{Approved: true, Command: command}
+			}
+		}
+	}
+}
+
+// stdinIsTerminal is false when clan runs non-interactively, for example
+// in CI or with stdin redirected
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// askInput shows the summaries and the question of e on out and returns
+// the --answer flag when e is the question the run stopped waiting for, or a
+// line typed on the terminal. ok is false when there is no terminal to
+// answer on, the question is then postponed so that the run can be resumed
+// with --answer.
+func askInput(ctx context.Context, e workflow.InputRequested, out io.Writer, opts *options) (answer string, ok bool) {
+	for _, summary := range e.Summaries {
+		fmt.Fprintf(out, color.MagentaString("SUMMARY: %s\n")+"%s\n", summary.AgentName, summary.Summary)
+	}
+	fmt.Fprintf(out, color.RedString("QUESTION FROM %s: ")+"%s\n", e.Agent, e.Question)
+
+	if opts.answer != "" && e.Pending {
+		answer = opts.answer
+		opts.answer = ""
+		fmt.Fprintf(out, "Answer: %s\n", answer)
+		return answer, true
+	}
+
+	if !stdinIsTerminal() {
+		return "", false
+	}
+
+	for {
+		fmt.Fprint(out, "Answer: ")
+		answer, ok = readLine(ctx)
+		if !ok {
+			fmt.Fprintln(out)
+			return "", false
+		}
+		if answer != "" {
+			return answer, true
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"clan/pkg/planning"
+	"clan/pkg/workflow"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/fatih/color"
+	"github.com/mitchellh/go-wordwrap"
+	"github.com/rodaine/table"
+)
+
+// render prints the events of a run and asks on the terminal for the
+// approvals and answers it needs
+func render(ctx context.Context, events <-chan workflow.Event, opts *options) {
+	streamingAgent := ""
+	streamed := false
+	agentColor := color.New(color.Bold).SprintFunc()
+	for event := range events {
+		switch e := event.(type) {
+		case workflow.ModelDelta:
+			if streamingAgent == "" {
+				streamingAgent = e.AgentName
+				fmt.Printf(color.BlueString("AGENT NAME: ")+agentColor(" %s\n"), e.AgentName)
+			}
+
+			switch e.Delta.ContentType {
+			case "text":
+				fmt.Print(e.Delta.Text)
+			case "tool_use":
+				if e.Delta.Name != "" {
+					fmt.Printf(color.YellowString("\nCALLING TOOL: %s\n"), e.Delta.Name)
+				}
+			}
+
+		case workflow.ModelResponded:
+			// A streamed response has already been printed
+			streamed = e.Streamed
+			if streamed {
+				fmt.Println()
+				streamingAgent = ""
+				continue
+			}
+
+			fmt.Printf(color.BlueString("AGENT NAME: ")+agentColor(" %s\n"), e.Agent)
+			text := e.Text()
+			if text != "" {
+				fmt.Printf("%s\n", text)
+			}
+
+		case workflow.ToolCalled:
+			if !streamed {
+				fmt.Printf(color.YellowString("CALLING TOOL: %s\n"), e.Tool)
+			}
+
+		case workflow.ToolReturned:
+			fmt.Printf(color.CyanString("TOOL RESULT: \n%s\n", e.Result))
+
+		case workflow.ApprovalRequested:
+			e.Respond(approve(ctx, e, os.Stdout))
+
+		case workflow.InputRequested:
+			answer, ok := askInput(ctx, e, os.Stdout, opts)
+			if !ok {
+				e.Postpone()
+				continue
+			}
+			e.Answer(answer)
+
+		case workflow.PlanUpdated:
+			printPlan(e.Plan)
+
+		case workflow.Handover:
+			fmt.Printf(color.MagentaString("HANDOVER: %s -> %s\n")+"%s\n", e.From, e.To, e.Summary)
+
+		case workflow.RunCompleted:
+			printUsage(e.State)
+
+		case workflow.RunFailed:
+			printUsage(e.State)
+
+			switch e.Reason {
+			case workflow.StopBudgetExceeded:
+				fmt.Println(color.RedString("STOPPED: %s", e.Err))
+				fmt.Printf("Raise the budget and run `clan resume %s <manifest>` to continue\n", e.WorkflowID)
+			case workflow.StopTraversalDepth:
+				fmt.Println(color.RedString("STOPPED: %s", e.Err))
+				fmt.Printf("Raise traversal_depth and run `clan resume %s <manifest>` to continue\n", e.WorkflowID)
+			case workflow.StopAwaitingInput:
+				fmt.Println(color.RedString("WAITING FOR INPUT: %s", e.Err))
+				fmt.Printf("Run `clan resume %s <manifest> --answer <answer>` to continue\n", e.WorkflowID)
+			case workflow.StopInterrupted:
+				fmt.Println(color.YellowString("PAUSED: %s", e.Err))
+				fmt.Printf("Review the state with `clan runs state %s <manifest>`, change it with `clan runs edit %s <manifest>` and run `clan resume %s <manifest>` to continue\n", e.WorkflowID, e.WorkflowID, e.WorkflowID)
+			case workflow.StopCancelled:
+				fmt.Println(color.RedString("INTERRUPTED: %s", e.Err))
+				fmt.Printf("Run `clan resume %s <manifest>` to continue\n", e.WorkflowID)
+			default:
+				fmt.Println(color.RedString("FAILED: %s", e.Err))
+			}
+		}
+	}
+}
+
+func printPlan(plan []planning.Task) {
+	fmt.Println(color.New(color.Bold).Sprint("Plan"))
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+	tbl := table.New("Name", "Description", "Owner", "Status")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+	for _, task := range plan {
+		tbl.AddRow(task.Name, wordwrap.WrapString(task.Description, 100), task.Owner, task.Status)
+	}
+	tbl.Print()
+}
+
+func printUsage(state workflow.WorkflowState) {
+	if state.TotalUsage.Calls == 0 {
+		return
+	}
+
+	agentNames := []string{}
+	for name := range state.AgentUsage {
+		agentNames = append(agentNames, name)
+	}
+	sort.Strings(agentNames)
+
+	fmt.Println(color.New(color.Bold).Sprint("Usage"))
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+	tbl := table.New("Agent", "Calls", "Input", "Output", "Cache Write", "Cache Read", "Cost (USD)")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+	addRow := func(name string, us workflow.UsageSummary) {
+		tbl.AddRow(name, us.Calls, us.InputTokens, us.OutputTokens, us.CacheCreationInputTokens, us.CacheReadInputTokens, fmt.Sprintf("%.4f", us.Cost))
+	}
+	for _, name := range agentNames {
+		addRow(name, state.AgentUsage[name])
+	}
+	addRow("Total", state.TotalUsage)
+	tbl.Print()
+}